@@ -0,0 +1,93 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"time"
+
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// atCmd represents the at command
+var atCmd = &cobra.Command{
+	Use:   "at <timestamp>",
+	Short: "Переключает репозитории на состояние основной ветки на указанный момент времени",
+	Long: `Для каждого репозитория находит последний коммит основной ветки на указанный момент времени (или раньше)
+и делает его checkout (detached HEAD). Формат времени: "2026-09-01", "2026-09-01 12:00", "2026-09-01T12:00:00+03:00"
+(без часового пояса - локальное время).
+Репозитории с незакоммиченными изменениями пропускаются.
+С флагом --back репозитории, переключённые at, возвращаются на ветки, на которых были до этого
+(или на основную ветку, если были в detached HEAD), остальные не трогаются.`,
+	Example: `mpcreator at "2026-09-01 12:00" -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken
+mpcreator at --back -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+	Args: cobra.MaximumNArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		back, err := cmd.Flags().GetBool("back")
+		if err != nil {
+			return errors.Wrap(err, "failed to get back flag")
+		}
+		if back == (len(args) == 1) {
+			return errors.New("either timestamp or --back is required")
+		}
+		var at time.Time
+		if !back {
+			at, err = app.ParseTime(args[0])
+			if err != nil {
+				return errors.Wrap(err, "failed to parse timestamp")
+			}
+		}
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		if back {
+			err = app.ReturnSubmodulesToBranches(filter)
+			if err != nil {
+				return errors.Wrap(err, "failed to app.ReturnSubmodulesToBranches")
+			}
+			return nil
+		}
+
+		err = app.CheckoutSubmodulesAt(filter, at)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.CheckoutSubmodulesAt")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(atCmd)
+
+	atCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	atCmd.MarkFlagRequired("mppath")
+	atCmd.MarkFlagDirname("mppath")
+
+	atCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	atCmd.MarkFlagRequired("url")
+
+	atCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	atCmd.MarkFlagRequired("token")
+
+	addFilterFlags(atCmd)
+
+	atCmd.Flags().Bool("back", false, "return repos to the branches they were on before")
+}
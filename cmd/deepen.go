@@ -0,0 +1,80 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// deepenCmd represents the deepen command
+var deepenCmd = &cobra.Command{
+	Use:   "deepen",
+	Short: "Докачивает историю в неполных (shallow / partial) клонах",
+	Long: `Докачивает историю в неполных клонах репозиториев (см. fill --depth / --filter / --single-branch):
+по умолчанию shallow репозитории докачиваются полностью (git fetch --unshallow),
+--by N докачивает только N коммитов, --all-branches - остальные ветки,
+--unfilter - недостающие объекты partial clone.`,
+	Example: `mpcreator deepen --ingroups "some-group" -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		opts := app.DeepenOptions{}
+		opts.By, err = cmd.Flags().GetInt("by")
+		if err != nil {
+			return errors.Wrap(err, "failed to get by flag")
+		}
+		opts.AllBranches, err = cmd.Flags().GetBool("all-branches")
+		if err != nil {
+			return errors.Wrap(err, "failed to get all-branches flag")
+		}
+		opts.Unfilter, err = cmd.Flags().GetBool("unfilter")
+		if err != nil {
+			return errors.Wrap(err, "failed to get unfilter flag")
+		}
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.DeepenSubmodules(filter, opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.DeepenSubmodules")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deepenCmd)
+
+	deepenCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	deepenCmd.MarkFlagRequired("mppath")
+	deepenCmd.MarkFlagDirname("mppath")
+
+	deepenCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	deepenCmd.MarkFlagRequired("url")
+
+	deepenCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	deepenCmd.MarkFlagRequired("token")
+
+	addFilterFlags(deepenCmd)
+
+	deepenCmd.Flags().Int("by", 0, "deepen history by N commits, 0 - fetch full history")
+	deepenCmd.Flags().Bool("all-branches", false, "fetch all branches for --single-branch clones")
+	deepenCmd.Flags().Bool("unfilter", false, "fetch all objects missing in partial (--filter) clones")
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Ищет типичные проблемы в главном проекте и репозиториях",
+	Long: `Ищет типичные проблемы в главном проекте и репозиториях и объясняет каждую:
+незарегистрированные репозитории в папках главного проекта, брошенные .git/modules,
+несклонированные сабмодули, отсутствующий origin/HEAD, отсутствующая отслеживаемая ветка,
+расхождение url, закоммиченные в главный проект коммиты которых нет в репозитории, detached HEAD.
+С --fix исправляет безопасные проблемы.
+-u/-t не обязательны, с ними основная ветка дополнительно проверяется через gitlab.`,
+	Example: `mpcreator doctor -p /home/derbenev/go/src/project
+mpcreator doctor --fix -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		fix, err := cmd.Flags().GetBool("fix")
+		if err != nil {
+			return errors.Wrap(err, "failed to get fix flag")
+		}
+
+		var gitlabClient *gitlab.Client
+		switch {
+		case gitlabURL != "" && gitlabToken != "":
+			gitlabClient, err = gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+			if err != nil {
+				return errors.Wrap(err, "failed to gitlab.NewClient")
+			}
+		case len(filter.IncludeLanguages) != 0 || len(filter.ExcludeLanguages) != 0:
+			return errors.New(`required flag(s) "token", "url" not set`)
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.Doctor(filter, fix)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.Doctor")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	doctorCmd.MarkFlagRequired("mppath")
+	doctorCmd.MarkFlagDirname("mppath")
+
+	doctorCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	doctorCmd.Flags().StringP("token", "t", "", "gitlab api token")
+
+	addFilterFlags(doctorCmd)
+
+	doctorCmd.Flags().Bool("fix", false, "fix the safe problems")
+}
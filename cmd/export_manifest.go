@@ -0,0 +1,85 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// exportManifestCmd represents the export-manifest command
+var exportManifestCmd = &cobra.Command{
+	Use:   "export-manifest",
+	Short: "Сохраняет список репозиториев в файл манифеста",
+	Long: `Сохраняет список репозиториев (путь, url, основная ветка, группы, языки) в файл манифеста
+(.yaml, .toml или .xml по расширению), из которого можно заполнить главный проект без доступа к gitlab api (fill --manifest).
+По умолчанию список берётся из сабмодулей главного проекта (без -u/-t группы берутся из путей, а языки не сохраняются),
+с --from-gitlab - из gitlab, так же как их выбирает fill.`,
+	Example: `mpcreator export-manifest -o manifest.yaml -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken
+mpcreator export-manifest --from-gitlab --ingroups "some-group" -o manifest.xml -p . -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		sources, err := getSources(cmd)
+		if err != nil {
+			return err
+		}
+		kinds, err := getKinds(cmd)
+		if err != nil {
+			return err
+		}
+		fromGitlab, err := cmd.Flags().GetBool("from-gitlab")
+		if err != nil {
+			return errors.Wrap(err, "failed to get from-gitlab flag")
+		}
+		manifestPath := cmd.Flags().Lookup("output").Value.String()
+
+		var gitlabClient *gitlab.Client
+		switch {
+		case gitlabURL != "" && gitlabToken != "":
+			gitlabClient, err = gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+			if err != nil {
+				return errors.Wrap(err, "failed to gitlab.NewClient")
+			}
+		case fromGitlab || len(filter.IncludeLanguages) != 0 || len(filter.ExcludeLanguages) != 0:
+			return errors.New(`required flag(s) "token", "url" not set`)
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.ExportManifest(filter, sources, kinds, fromGitlab, manifestPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.ExportManifest")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportManifestCmd)
+
+	exportManifestCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	exportManifestCmd.MarkFlagRequired("mppath")
+	exportManifestCmd.MarkFlagDirname("mppath")
+
+	exportManifestCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru (required with --from-gitlab)")
+	exportManifestCmd.Flags().StringP("token", "t", "", "gitlab api token (required with --from-gitlab)")
+
+	addFilterFlags(exportManifestCmd)
+	addSourcesFlags(exportManifestCmd)
+	addKindsFlags(exportManifestCmd)
+
+	exportManifestCmd.Flags().Bool("from-gitlab", false, "export gitlab projects (selected the same way as by fill) instead of main project submodules")
+	exportManifestCmd.Flags().StringP("output", "o", "manifest.yaml", "manifest path, .yaml, .toml or .xml")
+}
@@ -19,36 +19,95 @@ var fillCmd = &cobra.Command{
 	Long: `Заполняет главный проект:
 создаёт (mkdir, git init) главный репозиторий (если его нет) по указанному пути,
 добавляет туда все репозитории из гитлаба как подмодули. 
-Если репозиторий уже есть - просто добавляет его в список подмодулей (не трогаает изменения)`,
-	Example: `mpcreator fill -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+Если репозиторий уже есть - просто добавляет его в список подмодулей (не трогаает изменения).
+С --manifest репозитории берутся из файла манифеста (.yaml, .toml или .xml, см. export-manifest):
+без -u/-t - только из манифеста (доступ к gitlab api не нужен), с -u/-t - в дополнение к проектам из gitlab
+(например репозитории с github или git сервера вендора).`,
+	Example: `mpcreator fill -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken
+mpcreator fill -p /home/derbenev/go/src/project --manifest manifest.yaml`,
 
 	RunE: func(cmd *cobra.Command, args []string) error {
 		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
 		gitlabURL := cmd.Flags().Lookup("url").Value.String()
 		gitlabToken := cmd.Flags().Lookup("token").Value.String()
-		includeGroups, err := cmd.Flags().GetStringSlice("ingroups")
+		filter, err := getFilter(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get ingroup flag")
+			return err
 		}
-		excludeGroups, err := cmd.Flags().GetStringSlice("exgroups")
+		sources, err := getSources(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get exgroup flag")
+			return err
 		}
-		includeProjects, err := cmd.Flags().GetStringSlice("inprojects")
+		kinds, err := getKinds(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get inproject flag")
+			return err
 		}
-		excludeProjects, err := cmd.Flags().GetStringSlice("exprojects")
+		kinds.Upstream, err = cmd.Flags().GetBool("upstream")
 		if err != nil {
-			return errors.Wrap(err, "failed to get exproject flag")
+			return errors.Wrap(err, "failed to get upstream flag")
 		}
-		includeLanguages, err := cmd.Flags().GetStringSlice("inlang")
+		sizeLimit := app.SizeLimit{}
+		sizeLimit.MaxRepoSize, err = app.ParseSize(cmd.Flags().Lookup("max-repo-size").Value.String())
 		if err != nil {
-			return errors.Wrap(err, "failed to get inlang flag")
+			return errors.Wrap(err, "failed to parse max-repo-size flag")
 		}
-		excludeLanguages, err := cmd.Flags().GetStringSlice("exlang")
+		largeRepos, err := getEnumFlag(cmd, "large-repos", string(app.LargeReposSkip), string(app.LargeReposShallow))
 		if err != nil {
-			return errors.Wrap(err, "failed to get exlang flag")
+			return err
+		}
+		sizeLimit.LargeRepos = app.LargeReposMode(largeRepos)
+		sizeLimit.Report, err = cmd.Flags().GetBool("size-report")
+		if err != nil {
+			return errors.Wrap(err, "failed to get size-report flag")
+		}
+		cloneOpts := app.CloneOptions{}
+		cloneOpts.Depth, err = cmd.Flags().GetInt("depth")
+		if err != nil {
+			return errors.Wrap(err, "failed to get depth flag")
+		}
+		cloneOpts.Filter = cmd.Flags().Lookup("filter").Value.String()
+		cloneOpts.SingleBranch, err = cmd.Flags().GetBool("single-branch")
+		if err != nil {
+			return errors.Wrap(err, "failed to get single-branch flag")
+		}
+		cloneOpts.Sparse, err = getSparseProfiles()
+		if err != nil {
+			return err
+		}
+		cloneOpts.RecursiveDepth, err = getRecursiveDepth(cmd)
+		if err != nil {
+			return err
+		}
+		cloneOpts.LFS, err = getLFSOptions(cmd)
+		if err != nil {
+			return err
+		}
+		doctorRemotes, err := getEnumFlag(cmd, "doctor-remotes", string(app.RemotesCheckReport), string(app.RemotesCheckFix), string(app.RemotesCheckOff))
+		if err != nil {
+			return err
+		}
+		remotesCheck := app.RemotesCheck(doctorRemotes)
+		commit, err := cmd.Flags().GetBool("commit")
+		if err != nil {
+			return errors.Wrap(err, "failed to get commit flag")
+		}
+		reportOpts, err := getReportOptions(cmd)
+		if err != nil {
+			return err
+		}
+
+		manifestPath := cmd.Flags().Lookup("manifest").Value.String()
+		if manifestPath != "" && (gitlabURL == "" || gitlabToken == "") { // manifest only
+			cmd.SilenceUsage = true
+			app := app.NewApp(mainProjectPath, nil, zap.S())
+			err = app.FillMainProjectFromManifest(manifestPath, filter, cloneOpts, commit, reportOpts)
+			if err != nil {
+				return errors.Wrap(err, "failed to app.FillMainProjectFromManifest")
+			}
+			return nil
+		}
+		if gitlabURL == "" || gitlabToken == "" {
+			return errors.New(`required flag(s) "token", "url" not set (or use --manifest)`)
 		}
 
 		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
@@ -56,11 +115,19 @@ var fillCmd = &cobra.Command{
 			return errors.Wrap(err, "failed to gitlab.NewClient")
 		}
 
+		sources.Manifest = manifestPath
+
+		cmd.SilenceUsage = true // flags are valid, don't print usage on failed projects
 		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
 		err = app.FillMainProject(
-			includeGroups, excludeGroups,
-			includeProjects, excludeProjects,
-			includeLanguages, excludeLanguages,
+			filter,
+			sources,
+			kinds,
+			sizeLimit,
+			cloneOpts,
+			remotesCheck,
+			commit,
+			reportOpts,
 		)
 		if err != nil {
 			return errors.Wrap(err, "failed to app.FillMainProject")
@@ -87,16 +154,29 @@ func init() {
 	fillCmd.MarkFlagRequired("mppath")
 	fillCmd.MarkFlagDirname("mppath")
 
-	fillCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
-	fillCmd.MarkFlagRequired("url")
+	fillCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru (required without --manifest)")
+	fillCmd.Flags().StringP("token", "t", "", "gitlab api token (required without --manifest)")
+	fillCmd.Flags().String("manifest", "", "manifest file (.yaml, .toml or .xml, see export-manifest) with repos to fill, used instead of gitlab without -u/-t and besides gitlab with -u/-t")
+
+	addFilterFlags(fillCmd)
+
+	addSourcesFlags(fillCmd)
+
+	addKindsFlags(fillCmd)
+	fillCmd.Flags().Bool("upstream", false, `add "upstream" remote pointing to the original project for cloned forks`)
+
+	fillCmd.Flags().String("max-repo-size", "", `max repository size (gitlab statistics) e.g. "500MB", larger repos are handled by --large-repos`)
+	fillCmd.Flags().String("large-repos", string(app.LargeReposSkip), "repos larger than --max-repo-size: skip|shallow")
+	fillCmd.Flags().Bool("size-report", false, "print repository size (gitlab statistics) of added repos per group at the end")
+
+	fillCmd.Flags().Int("depth", 0, "clone only last N commits (shallow clone), see deepen command")
+	fillCmd.Flags().String("filter", "", `partial clone filter e.g. "blob:none", see deepen command`)
+	fillCmd.Flags().Bool("single-branch", false, "clone only the default branch, see deepen command")
 
-	fillCmd.Flags().StringP("token", "t", "", "gitlab api token")
-	fillCmd.MarkFlagRequired("token")
+	addRecursiveFlags(fillCmd)
+	addLFSFlags(fillCmd)
 
-	fillCmd.Flags().StringSlice("ingroups", nil, `included groups e.g. "etp" or "etp,etp/parser"`)
-	fillCmd.Flags().StringSlice("exgroups", nil, `excluded groups e.g. "etp" or "etp,etp/parser"`)
-	fillCmd.Flags().StringSlice("inprojects", nil, `included projects e.g. "events-geo" or "events-overspeed,events-geo"`)
-	fillCmd.Flags().StringSlice("exprojects", nil, `excluded projects e.g. "events-geo" or "events-overspeed,events-geo"`)
-	fillCmd.Flags().StringSlice("inlang", nil, `included languages e.g. "Go" or "Go,CSS"`)
-	fillCmd.Flags().StringSlice("exlang", nil, `excluded languages e.g. "Go" or "Go,CSS"`)
+	fillCmd.Flags().String("doctor-remotes", string(app.RemotesCheckReport), "existing submodules which remote differs from the gitlab project (found by id): report|fix|off")
+	fillCmd.Flags().Bool("commit", false, "commit .gitmodules and added submodules to the main project with generated message")
+	addReportFlags(fillCmd)
 }
@@ -26,42 +26,59 @@ var pullCmd = &cobra.Command{
 		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
 		gitlabURL := cmd.Flags().Lookup("url").Value.String()
 		gitlabToken := cmd.Flags().Lookup("token").Value.String()
-		includeGroups, err := cmd.Flags().GetStringSlice("ingroups")
+		filter, err := getFilter(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get ingroup flag")
+			return err
 		}
-		excludeGroups, err := cmd.Flags().GetStringSlice("exgroups")
+		opts := app.PullOptions{}
+		opts.FetchUpstream, err = cmd.Flags().GetBool("upstream")
 		if err != nil {
-			return errors.Wrap(err, "failed to get exgroup flag")
+			return errors.Wrap(err, "failed to get upstream flag")
 		}
-		includeProjects, err := cmd.Flags().GetStringSlice("inprojects")
+		strategy, err := getEnumFlag(cmd, "strategy",
+			string(app.PullStrategyFFOnly), string(app.PullStrategyRebase), string(app.PullStrategyFetch),
+		)
+		if err != nil {
+			return err
+		}
+		opts.Strategy = app.PullStrategy(strategy)
+		opts.Autostash, err = cmd.Flags().GetBool("autostash")
+		if err != nil {
+			return errors.Wrap(err, "failed to get autostash flag")
+		}
+		opts.UpdateBranches, err = cmd.Flags().GetBool("update-branches")
+		if err != nil {
+			return errors.Wrap(err, "failed to get update-branches flag")
+		}
+		opts.RecursiveDepth, err = getRecursiveDepth(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get inproject flag")
+			return err
 		}
-		excludeProjects, err := cmd.Flags().GetStringSlice("exprojects")
+		opts.LFS, err = getLFSOptions(cmd)
 		if err != nil {
-			return errors.Wrap(err, "failed to get exproject flag")
+			return err
+		}
+		opts.Sparse, err = getSparseProfiles()
+		if err != nil {
+			return err
+		}
+		opts.Commit, err = cmd.Flags().GetBool("commit")
+		if err != nil {
+			return errors.Wrap(err, "failed to get commit flag")
+		}
+		opts.Report, err = getReportOptions(cmd)
+		if err != nil {
+			return err
 		}
-		// includeLanguages, err := cmd.Flags().GetStringSlice("inlang")
-		// if err != nil {
-		// 	return errors.Wrap(err, "failed to get inlang flag")
-		// }
-		// excludeLanguages, err := cmd.Flags().GetStringSlice("exlang")
-		// if err != nil {
-		// 	return errors.Wrap(err, "failed to get exlang flag")
-		// }
 
 		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
 		if err != nil {
 			return errors.Wrap(err, "failed to gitlab.NewClient")
 		}
 
+		cmd.SilenceUsage = true // flags are valid, don't print usage on failed projects
 		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
-		err = app.PullMainProjectSubmodules(
-			includeGroups, excludeGroups,
-			includeProjects, excludeProjects,
-			// includeLanguages, excludeLanguages,
-		)
+		err = app.PullMainProjectSubmodules(filter, opts)
 		if err != nil {
 			return errors.Wrap(err, "failed to app.PullMainProjectSubmodules")
 		}
@@ -93,10 +110,14 @@ func init() {
 	pullCmd.Flags().StringP("token", "t", "", "gitlab api token")
 	pullCmd.MarkFlagRequired("token")
 
-	pullCmd.Flags().StringSlice("ingroups", nil, `included groups e.g. "etp" or "etp,etp/parser"`)
-	pullCmd.Flags().StringSlice("exgroups", nil, `excluded groups e.g. "etp" or "etp,etp/parser"`)
-	pullCmd.Flags().StringSlice("inprojects", nil, `included projects e.g. "events-geo" or "events-overspeed,events-geo"`)
-	pullCmd.Flags().StringSlice("exprojects", nil, `excluded projects e.g. "events-geo" or "events-overspeed,events-geo"`)
-	// pullCmd.Flags().StringSlice("inlang", nil, `included languages e.g. "Go" or "Go,CSS"`)
-	// pullCmd.Flags().StringSlice("exlang", nil, `excluded languages e.g. "Go" or "Go,CSS"`)
+	addFilterFlags(pullCmd)
+
+	pullCmd.Flags().Bool("upstream", false, `also fetch "upstream" remote of forks (see fill --upstream)`)
+	pullCmd.Flags().String("strategy", string(app.PullStrategyFFOnly), "ff-only|rebase|fetch, rebase conflicts are aborted, fetch doesn't touch worktree")
+	pullCmd.Flags().Bool("update-branches", false, "for repos on a feature branch fast-forward local default and tracked branches without checkout (instead of skipping)")
+	addRecursiveFlags(pullCmd)
+	addLFSFlags(pullCmd)
+	pullCmd.Flags().Bool("autostash", false, "stash uncommitted changes before pull and apply them after (otherwise dirty repos are skipped)")
+	pullCmd.Flags().Bool("commit", false, "commit updated submodules to the main project with generated message")
+	addReportFlags(pullCmd)
 }
@@ -0,0 +1,103 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// remapRemotesCmd represents the remap-remotes command
+var remapRemotesCmd = &cobra.Command{
+	Use:   "remap-remotes",
+	Short: "Меняет url репозиториев (например при переезде gitlab)",
+	Long: `Меняет начало url репозиториев --from на --to (как git url.<base>.insteadOf)
+одновременно в .gitmodules, .git/config главного проекта и remote origin каждого репозитория.
+С --dry-run только выводит что будет изменено.
+С --check ничего не меняет, а выводит репозитории, remote которых не совпадает с SSHURLToRepo проекта в gitlab
+(в том числе remote на других хостах, кроме --check-exclude-hosts).`,
+	Example: `mpcreator remap-remotes --from "git@gitlab.old.ru:" --to "ssh://git@git.company.ru:2222/" --dry-run -p /home/derbenev/go/src/project
+mpcreator remap-remotes --check -p /home/derbenev/go/src/project -u https://git.company.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		opts := app.RemapOptions{}
+		opts.From = cmd.Flags().Lookup("from").Value.String()
+		opts.To = cmd.Flags().Lookup("to").Value.String()
+		opts.DryRun, err = cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return errors.Wrap(err, "failed to get dry-run flag")
+		}
+		check, err := cmd.Flags().GetBool("check")
+		if err != nil {
+			return errors.Wrap(err, "failed to get check flag")
+		}
+		if !check && opts.From == "" {
+			return errors.New(`required flag(s) "from" not set (or use --check)`)
+		}
+		if opts.From != "" && opts.To == "" {
+			return errors.New(`required flag(s) "to" not set`)
+		}
+		excludeHosts, err := cmd.Flags().GetStringSlice("check-exclude-hosts")
+		if err != nil {
+			return errors.Wrap(err, "failed to get check-exclude-hosts flag")
+		}
+
+		var gitlabClient *gitlab.Client
+		switch {
+		case gitlabURL != "" && gitlabToken != "":
+			gitlabClient, err = gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+			if err != nil {
+				return errors.Wrap(err, "failed to gitlab.NewClient")
+			}
+		case check || len(filter.IncludeLanguages) != 0 || len(filter.ExcludeLanguages) != 0:
+			return errors.New(`required flag(s) "token", "url" not set`)
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		if check {
+			err = app.CheckRemotes(filter, excludeHosts)
+			if err != nil {
+				return errors.Wrap(err, "failed to app.CheckRemotes")
+			}
+			return nil
+		}
+
+		err = app.RemapRemotes(filter, opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.RemapRemotes")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(remapRemotesCmd)
+
+	remapRemotesCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	remapRemotesCmd.MarkFlagRequired("mppath")
+	remapRemotesCmd.MarkFlagDirname("mppath")
+
+	remapRemotesCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru (required with --check)")
+	remapRemotesCmd.Flags().StringP("token", "t", "", "gitlab api token (required with --check)")
+
+	addFilterFlags(remapRemotesCmd)
+
+	remapRemotesCmd.Flags().String("from", "", `url prefix to replace e.g. "git@gitlab.old.ru:"`)
+	remapRemotesCmd.Flags().String("to", "", `new url prefix e.g. "ssh://git@git.company.ru:2222/" (required with --from)`)
+	remapRemotesCmd.Flags().Bool("dry-run", false, "only print what would be changed")
+	remapRemotesCmd.Flags().Bool("check", false, "report remotes not matching SSHURLToRepo of gitlab projects instead of remapping")
+	remapRemotesCmd.Flags().StringSlice("check-exclude-hosts", nil, `hosts of repos not from gitlab skipped by --check e.g. "github.com"`)
+}
@@ -0,0 +1,62 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair",
+	Short: "Исправляет отсутствующий origin/HEAD в репозиториях",
+	Long: `Исправляет отсутствующий origin/HEAD в репозиториях:
+без него не определяется основная ветка (pull, switch, reset-to-default).
+Основная ветка берётся из gitlab (DefaultBranch) или из git ls-remote --symref origin HEAD.`,
+	Example: `mpcreator repair -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.RepairSubmodulesOriginHead(filter)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.RepairSubmodulesOriginHead")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(repairCmd)
+
+	repairCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	repairCmd.MarkFlagRequired("mppath")
+	repairCmd.MarkFlagDirname("mppath")
+
+	repairCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	repairCmd.MarkFlagRequired("url")
+
+	repairCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	repairCmd.MarkFlagRequired("token")
+
+	addFilterFlags(repairCmd)
+}
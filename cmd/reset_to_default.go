@@ -0,0 +1,63 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// resetToDefaultCmd represents the reset-to-default command
+var resetToDefaultCmd = &cobra.Command{
+	Use:   "reset-to-default",
+	Short: "Возвращает репозитории на основную ветку",
+	Long: `Возвращает репозитории на основную ветку:
+для каждого репозитория без незакоммиченных изменений и незапушенных коммитов
+переключается на основную ветку (origin/HEAD или DefaultBranch из gitlab) и делает fast-forward.
+В конце выводится список репозиториев которые были пропущены и почему.`,
+	Example: `mpcreator reset-to-default -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.ResetSubmodulesToDefault(filter)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.ResetSubmodulesToDefault")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resetToDefaultCmd)
+
+	resetToDefaultCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	resetToDefaultCmd.MarkFlagRequired("mppath")
+	resetToDefaultCmd.MarkFlagDirname("mppath")
+
+	resetToDefaultCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	resetToDefaultCmd.MarkFlagRequired("url")
+
+	resetToDefaultCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	resetToDefaultCmd.MarkFlagRequired("token")
+
+	addFilterFlags(resetToDefaultCmd)
+}
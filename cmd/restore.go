@@ -0,0 +1,50 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var restoreCmd = &cobra.Command{
+	Use:   "restore <lockfile>",
+	Short: "Восстанавливает состояние репозиториев из lockfile",
+	Long: `Восстанавливает состояние репозиториев из lockfile (см. snapshot):
+недостающие репозитории клонируются, в каждом репозитории делается checkout сохранённого коммита (detached HEAD).
+Репозитории с незакоммиченными изменениями пропускаются.
+Доступ к gitlab api не нужен, фильтры --inlang/--exlang не применяются.`,
+	Example: `mpcreator restore 2026-10-18.lock.json -p /home/derbenev/go/src/project`,
+	Args:    cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+
+		app := app.NewApp(mainProjectPath, nil, zap.S())
+		err = app.Restore(filter, args[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to app.Restore")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	restoreCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	restoreCmd.MarkFlagRequired("mppath")
+	restoreCmd.MarkFlagDirname("mppath")
+
+	addFilterFlags(restoreCmd)
+}
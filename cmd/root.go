@@ -7,9 +7,12 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kiteggrad/mpcreator/internal/app"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -112,3 +115,204 @@ func initLogger(level string) *zap.Logger {
 
 	return logger
 }
+
+// getEnumFlag returns value of string flag, checking that it is one of allowed values
+func getEnumFlag(cmd *cobra.Command, name string, allowed ...string) (value string, err error) {
+	value, err = cmd.Flags().GetString(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get %s flag", name)
+	}
+	if !slices.Contains(allowed, value) {
+		return "", errors.Errorf("invalid %s flag value %q, allowed: %v", name, value, allowed)
+	}
+
+	return value, nil
+}
+
+// addFilterFlags adds include / exclude flags for groups, projects and languages (see getFilter)
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("ingroups", nil, `included groups e.g. "etp" or "etp,etp/parser"`)
+	cmd.Flags().StringSlice("exgroups", nil, `excluded groups e.g. "etp" or "etp,etp/parser"`)
+	cmd.Flags().StringSlice("inprojects", nil, `included projects e.g. "events-geo" or "events-overspeed,events-geo"`)
+	cmd.Flags().StringSlice("exprojects", nil, `excluded projects e.g. "events-geo" or "events-overspeed,events-geo"`)
+	cmd.Flags().StringSlice("inlang", nil, `included languages e.g. "Go" or "Go,CSS"`)
+	cmd.Flags().StringSlice("exlang", nil, `excluded languages e.g. "Go" or "Go,CSS"`)
+}
+
+// getFilter returns app.Filter from flags added by addFilterFlags
+func getFilter(cmd *cobra.Command) (filter app.Filter, err error) {
+	filter.IncludeGroups, err = cmd.Flags().GetStringSlice("ingroups")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get ingroup flag")
+	}
+	filter.ExcludeGroups, err = cmd.Flags().GetStringSlice("exgroups")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get exgroup flag")
+	}
+	filter.IncludeProjects, err = cmd.Flags().GetStringSlice("inprojects")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get inproject flag")
+	}
+	filter.ExcludeProjects, err = cmd.Flags().GetStringSlice("exprojects")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get exproject flag")
+	}
+	filter.IncludeLanguages, err = cmd.Flags().GetStringSlice("inlang")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get inlang flag")
+	}
+	filter.ExcludeLanguages, err = cmd.Flags().GetStringSlice("exlang")
+	if err != nil {
+		return app.Filter{}, errors.Wrap(err, "failed to get exlang flag")
+	}
+
+	return filter, nil
+}
+
+// addSourcesFlags adds flags for gitlab projects sources besides groups (see getSources)
+func addSourcesFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("owned", false, "include projects from your user namespace")
+	cmd.Flags().Bool("starred", false, "include projects starred by you")
+	cmd.Flags().Bool("shared", true, "include projects shared with the selected groups, --shared=false to exclude them")
+	cmd.Flags().String("usersdir", app.DefaultUsersDir, "directory for projects from user namespaces e.g. alice/tool -> users/alice/tool")
+	cmd.Flags().String("archived", string(app.ArchivedExclude), "archived projects: exclude|include|only, they are cloned into "+app.ArchiveDir+"/ dir")
+}
+
+// getSources returns app.Sources from flags added by addSourcesFlags
+func getSources(cmd *cobra.Command) (sources app.Sources, err error) {
+	sources.Owned, err = cmd.Flags().GetBool("owned")
+	if err != nil {
+		return app.Sources{}, errors.Wrap(err, "failed to get owned flag")
+	}
+	sources.Starred, err = cmd.Flags().GetBool("starred")
+	if err != nil {
+		return app.Sources{}, errors.Wrap(err, "failed to get starred flag")
+	}
+	if cmd.Flags().Changed("shared") { // otherwise gitlab default is used
+		shared, err := cmd.Flags().GetBool("shared")
+		if err != nil {
+			return app.Sources{}, errors.Wrap(err, "failed to get shared flag")
+		}
+		sources.Shared = &shared
+	}
+	sources.UsersDir = cmd.Flags().Lookup("usersdir").Value.String()
+	archived, err := getEnumFlag(cmd, "archived", string(app.ArchivedExclude), string(app.ArchivedInclude), string(app.ArchivedOnly))
+	if err != nil {
+		return app.Sources{}, err
+	}
+	sources.Archived = app.ArchivedMode(archived)
+
+	return sources, nil
+}
+
+// addKindsFlags adds flags for forks and mirrors selection (see getKinds)
+func addKindsFlags(cmd *cobra.Command) {
+	cmd.Flags().String("forks", string(app.ForksInclude), "forked projects: include|exclude|only")
+	cmd.Flags().String("mirrors", string(app.MirrorsInclude), "pull-mirror projects: include|exclude")
+}
+
+// getKinds returns app.Kinds from flags added by addKindsFlags
+func getKinds(cmd *cobra.Command) (kinds app.Kinds, err error) {
+	forks, err := getEnumFlag(cmd, "forks", string(app.ForksInclude), string(app.ForksExclude), string(app.ForksOnly))
+	if err != nil {
+		return app.Kinds{}, err
+	}
+	kinds.Forks = app.ForksMode(forks)
+	mirrors, err := getEnumFlag(cmd, "mirrors", string(app.MirrorsInclude), string(app.MirrorsExclude))
+	if err != nil {
+		return app.Kinds{}, err
+	}
+	kinds.Mirrors = app.MirrorsMode(mirrors)
+
+	return kinds, nil
+}
+
+// addRecursiveFlags adds flags for nested submodules handling (see getRecursiveDepth)
+func addRecursiveFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("recursive", false, "init and update nested submodules of repositories (pull also pulls them on tracking / default branch)")
+	cmd.Flags().Int("recursive-depth", app.DefaultRecursiveDepth, "max depth of nested submodules for --recursive")
+}
+
+// getRecursiveDepth returns max depth of nested submodules from flags added by addRecursiveFlags, 0 if not --recursive
+func getRecursiveDepth(cmd *cobra.Command) (depth int, err error) {
+	recursive, err := cmd.Flags().GetBool("recursive")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get recursive flag")
+	}
+	if !recursive {
+		return 0, nil
+	}
+
+	depth, err = cmd.Flags().GetInt("recursive-depth")
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to get recursive-depth flag")
+	}
+
+	return depth, nil
+}
+
+// addLFSFlags adds flags for git lfs handling (see getLFSOptions)
+func addLFSFlags(cmd *cobra.Command) {
+	cmd.Flags().String("lfs", string(app.LFSSkip), "git lfs objects of repos which use lfs: skip|fetch|pull (requires git-lfs)")
+	cmd.Flags().StringSlice("lfs-include", nil, `lfs paths to fetch e.g. "assets/**,*.psd"`)
+	cmd.Flags().StringSlice("lfs-exclude", nil, `lfs paths to not fetch e.g. "models/**"`)
+}
+
+// getLFSOptions returns app.LFSOptions from flags added by addLFSFlags
+func getLFSOptions(cmd *cobra.Command) (opts app.LFSOptions, err error) {
+	mode, err := getEnumFlag(cmd, "lfs", string(app.LFSSkip), string(app.LFSFetch), string(app.LFSPull))
+	if err != nil {
+		return app.LFSOptions{}, err
+	}
+	opts.Mode = app.LFSMode(mode)
+	opts.Include, err = cmd.Flags().GetStringSlice("lfs-include")
+	if err != nil {
+		return app.LFSOptions{}, errors.Wrap(err, "failed to get lfs-include flag")
+	}
+	opts.Exclude, err = cmd.Flags().GetStringSlice("lfs-exclude")
+	if err != nil {
+		return app.LFSOptions{}, errors.Wrap(err, "failed to get lfs-exclude flag")
+	}
+
+	return opts, nil
+}
+
+// addReportFlags adds flags for the run report of fill / pull (see getReportOptions)
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().String("report-file", "", "also write per project results to file: .json or .xml (JUnit)")
+	cmd.Flags().String("fail-on", string(app.FailOnFailed), "exit with error if any project: failed|skipped (failed or skipped)|never")
+}
+
+// getReportOptions returns app.ReportOptions from flags added by addReportFlags
+func getReportOptions(cmd *cobra.Command) (opts app.ReportOptions, err error) {
+	opts.File = cmd.Flags().Lookup("report-file").Value.String()
+	failOn, err := getEnumFlag(cmd, "fail-on", string(app.FailOnFailed), string(app.FailOnSkipped), string(app.FailOnNever))
+	if err != nil {
+		return app.ReportOptions{}, err
+	}
+	opts.FailOn = app.FailOn(failOn)
+	err = opts.Validate()
+	if err != nil {
+		return app.ReportOptions{}, errors.Wrap(err, "invalid report-file flag")
+	}
+
+	return opts, nil
+}
+
+// getSparseProfiles returns app.SparseProfiles from "sparse" section of the config file e.g.
+//
+//	sparse:
+//	  - projects: ["platform/monorepo"]
+//	    patterns: ["services/billing", "libs/common"]
+func getSparseProfiles() (profiles app.SparseProfiles, err error) {
+	err = viper.UnmarshalKey("sparse", &profiles)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to viper.UnmarshalKey(sparse)")
+	}
+	err = profiles.Validate()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid sparse config")
+	}
+
+	return profiles, nil
+}
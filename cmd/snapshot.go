@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Сохраняет текущие коммиты репозиториев в lockfile",
+	Long: `Сохраняет текущие коммиты выбранных репозиториев в lockfile (JSON):
+id проекта в gitlab, путь, url, ветка, коммит и его время.
+Позже это состояние можно восстановить командой restore.
+Незакоммиченные изменения и незапушенные коммиты не сохраняются (выводится WARN лог).`,
+	Example: `mpcreator snapshot -o 2026-10-18.lock.json -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		lockfilePath := cmd.Flags().Lookup("output").Value.String()
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.Snapshot(filter, lockfilePath)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.Snapshot")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+
+	snapshotCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	snapshotCmd.MarkFlagRequired("mppath")
+	snapshotCmd.MarkFlagDirname("mppath")
+
+	snapshotCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	snapshotCmd.MarkFlagRequired("url")
+
+	snapshotCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	snapshotCmd.MarkFlagRequired("token")
+
+	addFilterFlags(snapshotCmd)
+
+	snapshotCmd.Flags().StringP("output", "o", app.DefaultLockfile, "lockfile path")
+}
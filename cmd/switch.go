@@ -0,0 +1,82 @@
+/*
+Copyright © 2022 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"github.com/kiteggrad/mpcreator/internal/app"
+	"go.uber.org/zap"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/xanzy/go-gitlab"
+)
+
+// switchCmd represents the switch command
+var switchCmd = &cobra.Command{
+	Use:   "switch <branch>",
+	Short: "Переключает репозитории на указанную ветку",
+	Long: `Переключает репозитории на указанную ветку (git switch):
+если ветки нет ни локально ни в origin - репозиторий остаётся как есть
+(или ветка создаётся с --create, или репозиторий переключается на основную ветку с --fallback-default).
+Репозитории с незакоммиченными изменениями пропускаются (если не указан --autostash).
+В конце выводится список репозиториев в которых ветки не оказалось.`,
+	Example: `mpcreator switch release/2026.10 --fallback-default -p /home/derbenev/go/src/project -u https://gitlab.ru -t yourToken`,
+	Args:    cobra.ExactArgs(1),
+
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mainProjectPath := cmd.Flags().Lookup("mppath").Value.String()
+		gitlabURL := cmd.Flags().Lookup("url").Value.String()
+		gitlabToken := cmd.Flags().Lookup("token").Value.String()
+		filter, err := getFilter(cmd)
+		if err != nil {
+			return err
+		}
+		opts := app.SwitchOptions{}
+		opts.Create, err = cmd.Flags().GetBool("create")
+		if err != nil {
+			return errors.Wrap(err, "failed to get create flag")
+		}
+		opts.FallbackDefault, err = cmd.Flags().GetBool("fallback-default")
+		if err != nil {
+			return errors.Wrap(err, "failed to get fallback-default flag")
+		}
+		opts.Autostash, err = cmd.Flags().GetBool("autostash")
+		if err != nil {
+			return errors.Wrap(err, "failed to get autostash flag")
+		}
+
+		gitlabClient, err := gitlab.NewClient(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlab.NewClient")
+		}
+
+		app := app.NewApp(mainProjectPath, gitlabClient, zap.S())
+		err = app.SwitchSubmodulesBranch(filter, args[0], opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to app.SwitchSubmodulesBranch")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(switchCmd)
+
+	switchCmd.Flags().StringP("mppath", "p", "", "path to main project e.g. /home/derbenev/go/src/rnis")
+	switchCmd.MarkFlagRequired("mppath")
+	switchCmd.MarkFlagDirname("mppath")
+
+	switchCmd.Flags().StringP("url", "u", "", "gitlab url e.g. https://gitlab.ru")
+	switchCmd.MarkFlagRequired("url")
+
+	switchCmd.Flags().StringP("token", "t", "", "gitlab api token")
+	switchCmd.MarkFlagRequired("token")
+
+	addFilterFlags(switchCmd)
+
+	switchCmd.Flags().Bool("create", false, "create branch from origin/<default branch> if it is missing")
+	switchCmd.Flags().Bool("fallback-default", false, "switch to the default branch if branch is missing")
+	switchCmd.Flags().Bool("autostash", false, "stash uncommitted changes before switch and apply them after (otherwise dirty repos are skipped)")
+}
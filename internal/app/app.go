@@ -1,7 +1,10 @@
 package app
 
 import (
+	"bytes"
 	"os"
+	"os/exec"
+	"strings"
 
 	"go.uber.org/zap"
 
@@ -41,6 +44,63 @@ func (a *App) openMainProject() (mainProjectRepo *git.Repository, err error) {
 	return mainProjectRepo, nil
 }
 
+// selectSubmodules returns submodules of the main project which pass the filter
+func (a *App) selectSubmodules(filter Filter) (submodules git.Submodules, err error) {
+	mainProjectRepo, err := a.openMainProject()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to openMainProject")
+	}
+	wt, err := mainProjectRepo.Worktree()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to mainProjectRepo.Worktree")
+	}
+	allSubmodules, err := wt.Submodules()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to wt.Submodules")
+	}
+
+	for _, submodule := range allSubmodules {
+		pass, err := a.submodulePass(filter, submodule)
+		if err != nil {
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to submodulePass")
+
+			continue
+		}
+		if !pass {
+			continue
+		}
+
+		submodules = append(submodules, submodule)
+	}
+
+	return submodules, nil
+}
+
+// runGit runs git cli command in dir and returns it's trimmed stdout
+func runGit(dir string, args ...string) (stdout string, err error) {
+	return runGitEnv(dir, nil, args...)
+}
+
+// runGitEnv is runGit with additional environment variables e.g. "GIT_LFS_SKIP_SMUDGE=1"
+func runGitEnv(dir string, env []string, args ...string) (stdout string, err error) {
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(append(os.Environ(), "LC_ALL=C"), env...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to exec.Command(git "+strings.Join(args, " ")+") "+stderr.String())
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
 func openDir(directoryPath string, autocreate bool, log *zap.SugaredLogger) (dir *os.File, err error) {
 	dir, err = os.Open(directoryPath)
 	if err != nil {
@@ -4,9 +4,16 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"github.com/xanzy/go-gitlab"
 	"go.uber.org/goleak"
@@ -102,9 +109,18 @@ func (s *AppTestSuite) Test_FillMainProject() {
 	s.T().Skip()
 
 	err := s.app.FillMainProject(
-		[]string{"rupor"}, []string{}, // groups in / ex
-		[]string{"rupor-search-microservice"}, []string{}, // projects in / ex
-		[]string{"Go"}, []string{}, // languages in / ex
+		Filter{
+			IncludeGroups:    []string{"rupor"},
+			IncludeProjects:  []string{"rupor-search-microservice"},
+			IncludeLanguages: []string{"Go"},
+		},
+		Sources{},
+		Kinds{},
+		SizeLimit{},
+		CloneOptions{},
+		RemotesCheckReport,
+		false,
+		ReportOptions{},
 	)
 	s.NoError(err)
 }
@@ -112,7 +128,7 @@ func (s *AppTestSuite) Test_FillMainProject() {
 func (s *AppTestSuite) Test_PullMainProjectSubmodules() {
 	s.T().Skip()
 
-	err := s.app.PullMainProjectSubmodules(nil, nil, nil, nil)
+	err := s.app.PullMainProjectSubmodules(Filter{}, PullOptions{})
 	s.NoError(err)
 }
 
@@ -122,10 +138,12 @@ func (s *AppTestSuite) Test_AddSubmodule() {
 	mainRepo, err := s.app.initMainProject()
 	s.NoError(err)
 
-	submodule, err := addSubmoduleToRepo(
+	submodule, _, err := addSubmoduleToRepo(
 		mainRepo,
+		&sync.Mutex{},
 		"rupor/rupor-search-microservice",
 		"git@gitlab.cyrm.ru:rupor/rupor-search-microservice.git",
+		CloneOptions{},
 		s.log,
 	)
 	s.NoError(err)
@@ -158,9 +176,24 @@ func (s *AppTestSuite) Test_IterateGroupsProjects() {
 			fmt.Println("project", project.PathWithNamespace, project.SSHURLToRepo, languages)
 			return nil
 		},
-		[]string{"rupor"}, []string{}, // groups in / ex
-		[]string{}, []string{}, // projects in / ex
-		[]string{"Go"}, []string{}, // languages in / ex
+		Filter{
+			IncludeGroups:    []string{"rupor"},
+			IncludeLanguages: []string{"Go"},
+		},
+	)
+	s.NoError(err)
+}
+
+func (s *AppTestSuite) Test_IterateUserProjects() {
+	s.T().Skip()
+
+	err := s.app.iterateUserProjects(
+		func(project *gitlab.Project) (err error) {
+			fmt.Println("project", project.PathWithNamespace, Sources{}.projectPath(project))
+			return nil
+		},
+		Sources{Owned: true, Starred: true},
+		Filter{},
 	)
 	s.NoError(err)
 }
@@ -172,3 +205,652 @@ func (s *AppTestSuite) Test_FindDirectory() {
 	s.NoError(err)
 	_ = dir
 }
+
+func TestSourcesProjectPath(t *testing.T) {
+	groupProject := &gitlab.Project{
+		PathWithNamespace: "etp / parser / events-geo",
+		Namespace:         &gitlab.ProjectNamespace{Kind: "group"},
+	}
+	userProject := &gitlab.Project{
+		PathWithNamespace: "alice/tool",
+		Namespace:         &gitlab.ProjectNamespace{Kind: "user"},
+	}
+
+	assert.Equal(t, "etp/parser/events-geo", Sources{}.projectPath(groupProject))
+	assert.Equal(t, "users/alice/tool", Sources{}.projectPath(userProject))
+	assert.Equal(t, "people/alice/tool", Sources{UsersDir: "people"}.projectPath(userProject))
+
+	userProject.Archived = true
+	assert.Equal(t, "_archive/users/alice/tool", Sources{}.projectPath(userProject))
+}
+
+func TestKindsPass(t *testing.T) {
+	project := &gitlab.Project{}
+	fork := &gitlab.Project{ForkedFromProject: &gitlab.ForkParent{ID: 1}}
+	mirror := &gitlab.Project{Mirror: true}
+
+	assert.True(t, Kinds{}.pass(project))
+	assert.True(t, Kinds{}.pass(fork))
+	assert.True(t, Kinds{}.pass(mirror))
+
+	assert.True(t, Kinds{Forks: ForksExclude}.pass(project))
+	assert.False(t, Kinds{Forks: ForksExclude}.pass(fork))
+	assert.False(t, Kinds{Forks: ForksOnly}.pass(project))
+	assert.True(t, Kinds{Forks: ForksOnly}.pass(fork))
+
+	assert.False(t, Kinds{Mirrors: MirrorsExclude}.pass(mirror))
+	assert.True(t, Kinds{Mirrors: MirrorsExclude}.pass(project))
+}
+
+func TestParseSize(t *testing.T) {
+	for in, expected := range map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"10B":    10,
+		"1K":     1 << 10,
+		"500MB":  500 << 20,
+		"500 mb": 500 << 20,
+		"1.5GB":  3 << 29,
+	} {
+		size, err := ParseSize(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, expected, size, in)
+	}
+
+	_, err := ParseSize("big")
+	assert.Error(t, err)
+}
+
+func TestFilterFullPathPass(t *testing.T) {
+	assert.True(t, Filter{}.fullPathPass("platform/billing/api"))
+
+	assert.True(t, Filter{IncludeGroups: []string{"platform"}}.fullPathPass("platform/billing/api"))
+	assert.True(t, Filter{IncludeGroups: []string{"platform/billing"}}.fullPathPass("platform/billing/api"))
+	assert.True(t, Filter{IncludeGroups: []string{"billing"}}.fullPathPass("platform/billing/api"))
+	assert.False(t, Filter{IncludeGroups: []string{"platform/billing"}}.fullPathPass("platform/api"))
+	assert.False(t, Filter{ExcludeGroups: []string{"platform/billing"}}.fullPathPass("platform/billing/api"))
+	assert.False(t, Filter{IncludeGroups: []string{"api"}}.fullPathPass("platform/billing/api"))
+
+	assert.True(t, Filter{IncludeProjects: []string{"api"}}.fullPathPass("platform/billing/api"))
+	assert.False(t, Filter{IncludeProjects: []string{"billing"}}.fullPathPass("platform/billing/api"))
+	assert.False(t, Filter{ExcludeProjects: []string{"api"}}.fullPathPass("platform/billing/api"))
+}
+
+func TestFilterLanguagesPass(t *testing.T) {
+	languages := gitlab.ProjectLanguages{"Go": 90, "Makefile": 10}
+
+	assert.True(t, Filter{}.languagesPass(languages))
+	assert.True(t, Filter{IncludeLanguages: []string{"Go", "CSS"}}.languagesPass(languages))
+	assert.False(t, Filter{IncludeLanguages: []string{"CSS"}}.languagesPass(languages))
+	assert.False(t, Filter{ExcludeLanguages: []string{"Makefile"}}.languagesPass(languages))
+}
+
+func TestProjectPathFromURL(t *testing.T) {
+	for in, expected := range map[string]string{
+		"git@gitlab.ru:platform/billing/api.git":            "platform/billing/api",
+		"ssh://git@gitlab.ru:2222/platform/billing/api.git": "platform/billing/api",
+		"https://gitlab.ru/platform/billing/api.git":        "platform/billing/api",
+		"https://gitlab.ru/platform/billing/api":            "platform/billing/api",
+	} {
+		projectPath, err := projectPathFromURL(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, expected, projectPath, in)
+	}
+}
+
+func TestRemoteURLHost(t *testing.T) {
+	assert.Equal(t, "gitlab.ru", remoteURLHost("git@GitLab.ru:platform/api.git"))
+	assert.Equal(t, "gitlab.ru", remoteURLHost("ssh://git@gitlab.ru:2222/platform/api.git"))
+	assert.Equal(t, "github.com", remoteURLHost("https://github.com/org/repo.git"))
+	assert.Equal(t, "", remoteURLHost("/srv/git/repo.git"))
+
+	assert.True(t, isSameHost("gitlab.ru", "gitlab.ru"))
+	assert.True(t, isSameHost("ssh.gitlab.ru", "gitlab.ru"))
+	assert.False(t, isSameHost("github.com", "gitlab.ru"))
+	assert.False(t, isSameHost("", "gitlab.ru"))
+}
+
+func TestContainsRemoteURL(t *testing.T) {
+	urls := []string{"git@gitlab.ru:platform/api.git", "https://gitlab.ru/platform/proto"}
+
+	assert.True(t, containsRemoteURL(urls, "ssh://git@gitlab.ru/platform/api"))
+	assert.True(t, containsRemoteURL(urls, "git@gitlab.ru:Platform/Proto.git"))
+	assert.False(t, containsRemoteURL(urls, "git@github.com:platform/api.git"))
+	assert.False(t, containsRemoteURL(urls, "git@gitlab.ru:platform/billing.git"))
+}
+
+func TestSparseProfilesPatterns(t *testing.T) {
+	profiles := SparseProfiles{
+		{Projects: []string{"platform/monorepo"}, Patterns: []string{"services/billing"}},
+		{Projects: []string{"platform/*-mono", "data/warehouse"}, Patterns: []string{"libs/common", "tools"}},
+	}
+	assert.NoError(t, profiles.Validate())
+
+	for projectPath, expected := range map[string][]string{
+		"platform/monorepo":   {"services/billing"},
+		"platform/web-mono":   {"libs/common", "tools"},
+		"data/warehouse":      {"libs/common", "tools"},
+		"platform/api":        nil,
+		"platform/sub/x-mono": nil,
+	} {
+		patterns, found := profiles.patterns(projectPath)
+		assert.Equal(t, expected != nil, found, projectPath)
+		assert.Equal(t, expected, patterns, projectPath)
+	}
+
+	assert.Error(t, SparseProfiles{{Projects: []string{"platform/["}, Patterns: []string{"x"}}}.Validate())
+	assert.Error(t, SparseProfiles{{Projects: []string{"platform/api"}}}.Validate())
+	assert.Equal(t, []string{"libs/common", "services/billing"}, normalizeSparsePatterns([]string{"/services/billing/", "", "libs/common"}))
+}
+
+func TestLFSOptionsCloneEnv(t *testing.T) {
+	assert.Empty(t, LFSOptions{Mode: LFSSkip}.cloneEnv())
+	assert.Empty(t, LFSOptions{}.cloneEnv())
+	assert.Equal(t, []string{lfsSkipSmudgeEnv}, LFSOptions{Mode: LFSFetch}.cloneEnv())
+	assert.Equal(t, []string{lfsSkipSmudgeEnv}, LFSOptions{Mode: LFSPull}.cloneEnv())
+}
+
+func TestLockfileReadWrite(t *testing.T) {
+	lockfilePath := filepath.Join(t.TempDir(), DefaultLockfile)
+	lockfile := Lockfile{
+		CreatedAt: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Repos: []LockedRepo{
+			{ProjectID: 42, Path: "platform/api", URL: "git@gitlab.ru:platform/api.git", Branch: "main", Commit: "5850b1299b6db76c05621a74c21c24d56b313f78"},
+			{Path: "platform/web", URL: "git@gitlab.ru:platform/web.git", Commit: "b02efdd5850b1299b6db76c05621a74c21c24d56"},
+		},
+	}
+
+	assert.NoError(t, writeLockfile(lockfilePath, lockfile))
+	readed, err := readLockfile(lockfilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, lockfile, readed)
+
+	_, err = readLockfile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestParseTime(t *testing.T) {
+	for s, expected := range map[string]time.Time{
+		"2026-09-01":                time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local),
+		"2026-09-01 12:00":          time.Date(2026, 9, 1, 12, 0, 0, 0, time.Local),
+		" 2026-09-01T12:00:30 ":     time.Date(2026, 9, 1, 12, 0, 30, 0, time.Local),
+		"2026-09-01T12:00:00Z":      time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC),
+		"2026-09-01T12:00:00+03:00": time.Date(2026, 9, 1, 9, 0, 0, 0, time.UTC),
+	} {
+		parsed, err := ParseTime(s)
+		assert.NoError(t, err, s)
+		assert.True(t, expected.Equal(parsed), s)
+	}
+
+	_, err := ParseTime("yesterday")
+	assert.Error(t, err)
+}
+
+func TestParseGitlinkChanges(t *testing.T) {
+	rawDiff := strings.Join([]string{
+		":000000 100644 0000000000000000000000000000000000000000 1111111111111111111111111111111111111111 A\t.gitmodules",
+		":160000 160000 3cb6531299b6db76c05621a74c21c24d56b313f7 b02efdd299b6db76c05621a74c21c24d56b313f7 M\tplatform/api",
+		":000000 160000 0000000000000000000000000000000000000000 5850b1299b6db76c05621a74c21c24d56b313f78 A\tplatform/web",
+		":160000 000000 a1c913f299b6db76c05621a74c21c24d56b313f7 0000000000000000000000000000000000000000 D\tlegacy/tool",
+	}, "\n")
+
+	changes := parseGitlinkChanges(rawDiff)
+	assert.Equal(t, []gitlinkChange{
+		{Path: "legacy/tool", OldCommit: "a1c913f299b6db76c05621a74c21c24d56b313f7"},
+		{Path: "platform/api", OldCommit: "3cb6531299b6db76c05621a74c21c24d56b313f7", NewCommit: "b02efdd299b6db76c05621a74c21c24d56b313f7"},
+		{Path: "platform/web", NewCommit: "5850b1299b6db76c05621a74c21c24d56b313f78"},
+	}, changes)
+
+	changes[1].Commits = "2"
+	assert.Equal(t, `mpcreator pull: 1 added, 1 updated, 1 removed
+
+Added:
+  platform/web 5850b12
+Updated:
+  platform/api 3cb6531..b02efdd (+2 commits)
+Removed:
+  legacy/tool
+`, formatCommitMessage("pull", changes))
+	assert.Equal(t, "mpcreator fill: update .gitmodules\n", formatCommitMessage("fill", nil))
+}
+
+func TestManifestReadWrite(t *testing.T) {
+	manifest := Manifest{Projects: []ManifestProject{
+		{Path: "platform/api", URL: "git@gitlab.ru:platform/api.git", Branch: "main", Groups: []string{"platform"}, Languages: []string{"Go", "Shell"}},
+		{Path: "users/alice/tool", URL: "git@gitlab.ru:alice/tool.git"},
+	}}
+
+	for _, name := range []string{"manifest.yaml", "manifest.toml", "manifest.xml"} {
+		manifestPath := filepath.Join(t.TempDir(), name)
+		assert.NoError(t, writeManifest(manifestPath, manifest), name)
+		readed, err := readManifest(manifestPath)
+		assert.NoError(t, err, name)
+		assert.Equal(t, manifest, readed, name)
+	}
+}
+
+func TestManifestProjectPass(t *testing.T) {
+	project := ManifestProject{Path: "platform/billing/api", Groups: []string{"platform/billing"}, Languages: []string{"Go"}}
+
+	assert.True(t, project.pass(Filter{}))
+	assert.True(t, project.pass(Filter{IncludeGroups: []string{"platform"}, IncludeProjects: []string{"api"}, IncludeLanguages: []string{"Go"}}))
+	assert.False(t, project.pass(Filter{ExcludeGroups: []string{"billing"}}))
+	assert.False(t, project.pass(Filter{ExcludeProjects: []string{"api"}}))
+	assert.False(t, project.pass(Filter{IncludeLanguages: []string{"Python"}}))
+
+	project.Groups = nil // groups from path
+	assert.True(t, project.pass(Filter{IncludeGroups: []string{"platform/billing"}}))
+	assert.False(t, project.pass(Filter{IncludeGroups: []string{"data"}}))
+}
+
+func TestRemapURL(t *testing.T) {
+	remapped, changed := remapURL("git@gitlab.old.ru:platform/api.git", "git@gitlab.old.ru:", "ssh://git@git.company.ru:2222/")
+	assert.True(t, changed)
+	assert.Equal(t, "ssh://git@git.company.ru:2222/platform/api.git", remapped)
+
+	remapped, changed = remapURL("https://gitlab.old.ru/platform/api.git", "git@gitlab.old.ru:", "ssh://git@git.company.ru:2222/")
+	assert.False(t, changed)
+	assert.Equal(t, "https://gitlab.old.ru/platform/api.git", remapped)
+
+	_, changed = remapURL("git@git.company.ru:platform/api.git", "git@git.company.ru:", "git@git.company.ru:")
+	assert.False(t, changed)
+
+	assert.Equal(t,
+		[]string{"git@gitlab.ru:platform/api.git", "https://gitlab.ru/platform/api.git"},
+		submoduleURLs{
+			Gitmodules: "git@gitlab.ru:platform/api.git",
+			Config:     "git@gitlab.ru:platform/api.git",
+			Origin:     "https://gitlab.ru/platform/api.git",
+		}.distinct(),
+	)
+
+	err := NewApp(t.TempDir(), nil, zap.NewNop().Sugar()).RemapRemotes(Filter{}, RemapOptions{From: "git@gitlab.old.ru:"})
+	assert.Error(t, err)
+
+	assert.True(t, isExcludedHost("github.com", []string{"gitlab.ru", "github.com"}))
+	assert.True(t, isExcludedHost("eu.github.com", []string{"github.com"}))
+	assert.False(t, isExcludedHost("gitlab.old.ru", []string{"github.com"}))
+	assert.False(t, isExcludedHost("gitlab.old.ru", nil))
+}
+
+func TestMovedSubmodulePath(t *testing.T) {
+	assert.Equal(t, "", movedSubmodulePath(nil, "platform/api"))
+	assert.Equal(t, "", movedSubmodulePath([]string{"platform/api"}, "platform/api"))
+	assert.Equal(t, "", movedSubmodulePath([]string{"old/api", "platform/api"}, "platform/api"))
+	assert.Equal(t, "old/api", movedSubmodulePath([]string{"old/api"}, "platform/api"))
+}
+
+func TestRunReport(t *testing.T) {
+	report := newRunReport("pull")
+	report.add("b", pullOutcomeStatus(PullOutcomeSkippedDirty), string(PullOutcomeSkippedDirty), nil, time.Now())
+	report.add("a", pullOutcomeStatus(PullOutcomeUpToDate), string(PullOutcomeUpToDate), nil, time.Now())
+	assert.NoError(t, report.check(FailOnFailed))
+	assert.Error(t, report.check(FailOnSkipped))
+
+	report.add("c", ReportStatusUpdated, "", errors.New("failed to syncLFS"), time.Now())
+	assert.Error(t, report.check(FailOnFailed))
+	assert.NoError(t, report.check(FailOnNever))
+
+	file := filepath.Join(t.TempDir(), "report.xml")
+	buf := &strings.Builder{}
+	assert.NoError(t, report.finish(buf, ReportOptions{File: file}))
+	assert.Equal(t, []string{"a", "b", "c"}, []string{report.Results[0].Path, report.Results[1].Path, report.Results[2].Path})
+	assert.Equal(t, "", report.Results[0].Details)
+	assert.Equal(t, ReportStatusFailed, report.Results[2].Status)
+	assert.Contains(t, buf.String(), "failed to syncLFS")
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `tests="3" failures="1" skipped="1"`)
+
+	assert.Equal(t, []string{"a"}, report.paths(ReportStatusUpdated, ReportStatusUpToDate))
+	assert.Equal(t, []string{"a", "b", "c"}, report.paths())
+
+	assert.Error(t, ReportOptions{File: "report.txt"}.Validate())
+}
+
+// setupTestGit configures git for tests with local temp repos: identity, no user / system config,
+// file:// transport for submodules
+func setupTestGit(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"GIT_CONFIG_GLOBAL":   os.DevNull,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_COUNT":    "2",
+		"GIT_CONFIG_KEY_0":    "protocol.file.allow",
+		"GIT_CONFIG_VALUE_0":  "always",
+		"GIT_CONFIG_KEY_1":    "init.defaultBranch",
+		"GIT_CONFIG_VALUE_1":  "main",
+		"GIT_AUTHOR_NAME":     "test",
+		"GIT_AUTHOR_EMAIL":    "test@test",
+		"GIT_COMMITTER_NAME":  "test",
+		"GIT_COMMITTER_EMAIL": "test@test",
+	} {
+		t.Setenv(key, value)
+	}
+}
+
+// mustGit runs git in dir and fails the test on error
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// commitFile writes file into the repo and commits it, returns the commit
+func commitFile(t *testing.T, repoPath, name, content string) string {
+	t.Helper()
+	err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustGit(t, repoPath, "add", "--", name)
+	mustGit(t, repoPath, "commit", "-q", "-m", "update "+name)
+	return mustGit(t, repoPath, "rev-parse", "HEAD")
+}
+
+// newTestRemote creates bare repo <dir>/<name>.git with one commit on main and it's working clone <dir>/<name>,
+// returns paths of both
+func newTestRemote(t *testing.T, dir, name string) (remotePath, workPath string) {
+	t.Helper()
+	remotePath = filepath.Join(dir, name+".git")
+	workPath = filepath.Join(dir, name)
+	mustGit(t, dir, "init", "-q", "--bare", remotePath)
+	mustGit(t, dir, "clone", "-q", remotePath, workPath)
+	commitFile(t, workPath, "README.md", name)
+	mustGit(t, workPath, "push", "-q", "origin", "main")
+	return remotePath, workPath
+}
+
+func TestAddSubmoduleKeepsPulledNestedSubmodules(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	innerRemote, innerWork := newTestRemote(t, dir, "inner")
+	outerRemote, outerWork := newTestRemote(t, dir, "outer")
+	mustGit(t, outerWork, "submodule", "add", "-q", innerRemote, "inner")
+	mustGit(t, outerWork, "commit", "-q", "-m", "add inner")
+	mustGit(t, outerWork, "push", "-q", "origin", "main")
+
+	mainProjectPath := filepath.Join(dir, "mp")
+	mustGit(t, dir, "init", "-q", mainProjectPath)
+	mainProjectRepo, err := git.PlainOpen(mainProjectPath)
+	assert.NoError(t, err)
+	cloneOpts := CloneOptions{RecursiveDepth: DefaultRecursiveDepth}
+	log := zap.NewNop().Sugar()
+
+	_, added, err := addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, "outer", outerRemote, cloneOpts, log)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	nestedPath := filepath.Join(mainProjectPath, "outer", "inner")
+	assert.Equal(t, "", mustGit(t, nestedPath, "branch", "--show-current")) // recorded commit is checked out
+
+	// pull --recursive leaves the nested submodule on the default branch ahead of the recorded commit
+	pulled := commitFile(t, innerWork, "new.txt", "new")
+	mustGit(t, innerWork, "push", "-q", "origin", "main")
+	mustGit(t, nestedPath, "fetch", "-q", "origin")
+	mustGit(t, nestedPath, "switch", "-q", "main")
+	mustGit(t, nestedPath, "merge", "-q", "--ff-only", "origin/main")
+
+	_, added, err = addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, "outer", outerRemote, cloneOpts, log)
+	assert.NoError(t, err)
+	assert.False(t, added)
+	assert.Equal(t, "main", mustGit(t, nestedPath, "branch", "--show-current"))
+	assert.Equal(t, pulled, mustGit(t, nestedPath, "rev-parse", "HEAD"))
+}
+
+// newTestMainProject creates main project <dir>/mp with submodules (path: url) added like by fill
+func newTestMainProject(t *testing.T, dir string, submodules map[string]string) (app *App) {
+	t.Helper()
+	mainProjectPath := filepath.Join(dir, "mp")
+	mustGit(t, dir, "init", "-q", mainProjectPath)
+	mainProjectRepo, err := git.PlainOpen(mainProjectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for submodulePath, submoduleURL := range submodules {
+		_, _, err = addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, submodulePath, submoduleURL, CloneOptions{}, zap.NewNop().Sugar())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewApp(mainProjectPath, nil, zap.NewNop().Sugar())
+}
+
+// testSubmodule returns submodule of the main project by path
+func testSubmodule(t *testing.T, app *App, submodulePath string) (submodule *git.Submodule) {
+	t.Helper()
+	mainProjectRepo, err := app.openMainProject()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := mainProjectRepo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	submodule, err = wt.Submodule(submodulePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return submodule
+}
+
+func TestSwitchSubmoduleBranchCreatesFromDefaultBranch(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	remotePath, _ := newTestRemote(t, dir, "api")
+	app := newTestMainProject(t, dir, map[string]string{"api": remotePath})
+	repoPath := filepath.Join(app.mainProjectPath, "api")
+	mustGit(t, repoPath, "switch", "-q", "-c", "feature")
+	commitFile(t, repoPath, "feature.txt", "feature")
+
+	outcome, err := app.switchSubmoduleBranch(testSubmodule(t, app, "api"), "release/2026.10", SwitchOptions{Create: true}, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, SwitchOutcomeCreated, outcome)
+	assert.Equal(t, "release/2026.10", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, mustGit(t, repoPath, "rev-parse", "origin/main"), mustGit(t, repoPath, "rev-parse", "HEAD"))
+}
+
+func TestPullWithGitRebase(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	remotePath, workPath := newTestRemote(t, dir, "api")
+	app := newTestMainProject(t, dir, map[string]string{"api": remotePath})
+	repoPath := filepath.Join(app.mainProjectPath, "api")
+	rebaseOpts := PullOptions{Strategy: PullStrategyRebase}
+
+	// conflict is aborted, local commit stays as is
+	localCommit := commitFile(t, repoPath, "README.md", "local")
+	commitFile(t, workPath, "README.md", "remote")
+	mustGit(t, workPath, "push", "-q", "origin", "main")
+	outcome, err := pullWithGit(repoPath, "main", rebaseOpts, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, PullOutcomeConflictAborted, outcome)
+	assert.Equal(t, localCommit, mustGit(t, repoPath, "rev-parse", "HEAD"))
+	assert.Equal(t, "main", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, "", mustGit(t, repoPath, "status", "--porcelain"))
+
+	// without conflict local commit is rebased, uncommitted changes are kept with autostash
+	mustGit(t, repoPath, "reset", "-q", "--hard", "origin/main")
+	commitFile(t, repoPath, "local.txt", "local")
+	commitFile(t, workPath, "remote.txt", "remote")
+	mustGit(t, workPath, "push", "-q", "origin", "main")
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("dirty"), 0o644))
+
+	outcome, err = pullWithGit(repoPath, "main", rebaseOpts, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, PullOutcomeSkippedDirty, outcome)
+
+	outcome, err = pullWithGit(repoPath, "main", PullOptions{Strategy: PullStrategyRebase, Autostash: true}, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, PullOutcomeRebased, outcome)
+	assert.Equal(t, mustGit(t, repoPath, "rev-parse", "origin/main"), mustGit(t, repoPath, "rev-parse", "HEAD~1"))
+	assert.Equal(t, "M README.md", mustGit(t, repoPath, "status", "--porcelain"))
+
+	// conflict with autostash: uncommitted changes are applied back by rebase --abort
+	localCommit = commitFile(t, repoPath, "local.txt", "conflicting local")
+	commitFile(t, workPath, "local.txt", "conflicting remote")
+	mustGit(t, workPath, "push", "-q", "origin", "main")
+	outcome, err = pullWithGit(repoPath, "main", PullOptions{Strategy: PullStrategyRebase, Autostash: true}, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, PullOutcomeConflictAborted, outcome)
+	assert.Equal(t, localCommit, mustGit(t, repoPath, "rev-parse", "HEAD"))
+	assert.Equal(t, "M README.md", mustGit(t, repoPath, "status", "--porcelain"))
+}
+
+func TestUpdateSubmoduleBranches(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	remotePath, workPath := newTestRemote(t, dir, "api")
+	mustGit(t, workPath, "push", "-q", "origin", "main:topic")
+	app := newTestMainProject(t, dir, map[string]string{"api": remotePath})
+	repoPath := filepath.Join(app.mainProjectPath, "api")
+
+	// topic diverged from origin/topic, main is behind origin/main, feature is checked out
+	mustGit(t, repoPath, "branch", "-q", "--track", "topic", "origin/topic")
+	mustGit(t, repoPath, "switch", "-q", "topic")
+	localTopic := commitFile(t, repoPath, "topic.txt", "local")
+	mustGit(t, repoPath, "switch", "-q", "-c", "feature", "main")
+	feature := commitFile(t, repoPath, "feature.txt", "feature")
+	commitFile(t, workPath, "remote.txt", "remote")
+	mustGit(t, workPath, "push", "-q", "origin", "main", "main:topic")
+
+	outcome, err := app.updateSubmoduleBranches(testSubmodule(t, app, "api"), "feature", "main", app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, PullOutcomeBranchesUpdated, outcome)
+	assert.Equal(t, mustGit(t, repoPath, "rev-parse", "origin/main"), mustGit(t, repoPath, "rev-parse", "main"))
+	assert.Equal(t, localTopic, mustGit(t, repoPath, "rev-parse", "topic")) // diverged branch is skipped
+	assert.Equal(t, "feature", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, feature, mustGit(t, repoPath, "rev-parse", "HEAD"))
+	assert.Equal(t, "", mustGit(t, repoPath, "status", "--porcelain"))
+}
+
+func TestResetSubmoduleToDefault(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	remotePath, workPath := newTestRemote(t, dir, "api")
+	app := newTestMainProject(t, dir, map[string]string{"api": remotePath})
+	repoPath := filepath.Join(app.mainProjectPath, "api")
+	submodule := testSubmodule(t, app, "api")
+
+	// unpushed commits of the feature branch
+	mustGit(t, repoPath, "switch", "-q", "-c", "feature")
+	commitFile(t, repoPath, "feature.txt", "feature")
+	outcome, err := app.resetSubmoduleToDefault(submodule, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, ResetOutcomeSkippedUnpushed, outcome)
+	assert.Equal(t, "feature", mustGit(t, repoPath, "branch", "--show-current"))
+
+	// local default branch diverged from origin
+	mustGit(t, repoPath, "push", "-q", "origin", "feature")
+	mustGit(t, repoPath, "switch", "-q", "main")
+	localMain := commitFile(t, repoPath, "main.txt", "local")
+	mustGit(t, repoPath, "switch", "-q", "feature")
+	commitFile(t, workPath, "remote.txt", "remote")
+	mustGit(t, workPath, "push", "-q", "origin", "main")
+	outcome, err = app.resetSubmoduleToDefault(submodule, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, ResetOutcomeDiverged, outcome)
+	assert.Equal(t, "feature", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, localMain, mustGit(t, repoPath, "rev-parse", "main"))
+
+	// local default branch behind origin
+	mustGit(t, repoPath, "branch", "-q", "-f", "main", "main~1")
+	outcome, err = app.resetSubmoduleToDefault(submodule, app.log)
+	assert.NoError(t, err)
+	assert.Equal(t, ResetOutcomeReset, outcome)
+	assert.Equal(t, "main", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, mustGit(t, repoPath, "rev-parse", "origin/main"), mustGit(t, repoPath, "rev-parse", "HEAD"))
+}
+
+func TestAddSubmoduleAdoptsExistingClone(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	remotePath, _ := newTestRemote(t, dir, "api")
+	otherRemotePath, _ := newTestRemote(t, dir, "other")
+	app := newTestMainProject(t, dir, nil)
+	mainProjectRepo, err := app.openMainProject()
+	assert.NoError(t, err)
+	log := zap.NewNop().Sugar()
+
+	// clone made before fill with a local branch and uncommitted changes
+	repoPath := filepath.Join(app.mainProjectPath, "api")
+	mustGit(t, app.mainProjectPath, "clone", "-q", remotePath, "api")
+	mustGit(t, repoPath, "switch", "-q", "-c", "feature")
+	feature := commitFile(t, repoPath, "feature.txt", "feature")
+	assert.NoError(t, os.WriteFile(filepath.Join(repoPath, "README.md"), []byte("dirty"), 0o644))
+
+	_, added, err := addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, "api", remotePath, CloneOptions{}, log)
+	assert.NoError(t, err)
+	assert.True(t, added)
+	assert.Equal(t, "feature", mustGit(t, repoPath, "branch", "--show-current"))
+	assert.Equal(t, feature, mustGit(t, repoPath, "rev-parse", "feature"))
+	assert.Equal(t, "M README.md", mustGit(t, repoPath, "status", "--porcelain"))
+	gitDir, err := os.Stat(filepath.Join(repoPath, ".git"))
+	assert.NoError(t, err)
+	assert.False(t, gitDir.IsDir()) // absorbed into .git/modules of the main project
+	assert.Equal(t, remotePath, mustGit(t, app.mainProjectPath, "config", "-f", gitmodulesFile, "--get", "submodule.api.url"))
+
+	// clone of another repo is not adopted
+	mustGit(t, app.mainProjectPath, "clone", "-q", otherRemotePath, "wrong")
+	_, _, err = addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, "wrong", remotePath, CloneOptions{}, log)
+	assert.Error(t, err)
+}
+
+func TestDoctorDiagnose(t *testing.T) {
+	setupTestGit(t)
+	dir := t.TempDir()
+	apiRemotePath, _ := newTestRemote(t, dir, "api")
+	libRemotePath, _ := newTestRemote(t, dir, "lib")
+	oldRemotePath, _ := newTestRemote(t, dir, "old")
+	app := newTestMainProject(t, dir, map[string]string{"api": apiRemotePath, "lib": libRemotePath, "old": oldRemotePath})
+
+	// removed submodule leaves it's git dir in .git/modules
+	mustGit(t, app.mainProjectPath, "submodule", "deinit", "-q", "-f", "old")
+	mustGit(t, app.mainProjectPath, "rm", "-q", "-f", "old")
+	// clone not registered as submodule
+	mustGit(t, app.mainProjectPath, "clone", "-q", apiRemotePath, "tools/api")
+	// origin/HEAD is missing, the default branch can be resolved from origin
+	apiPath := filepath.Join(app.mainProjectPath, "api")
+	mustGit(t, apiPath, "remote", "set-head", "origin", "-d")
+	mustGit(t, apiPath, "checkout", "-q", "--detach")
+	// origin/HEAD is missing and origin is unavailable
+	libPath := filepath.Join(app.mainProjectPath, "lib")
+	mustGit(t, libPath, "remote", "set-head", "origin", "-d")
+	assert.NoError(t, os.Rename(libRemotePath, libRemotePath+".moved"))
+
+	mainProjectRepo, err := app.openMainProject()
+	assert.NoError(t, err)
+	wt, err := mainProjectRepo.Worktree()
+	assert.NoError(t, err)
+	submodules, err := wt.Submodules()
+	assert.NoError(t, err)
+
+	findings, err := app.diagnoseMainProject(Filter{}, submodules)
+	assert.NoError(t, err)
+	for _, submodule := range submodules {
+		findings = append(findings, app.diagnoseSubmodule(submodule)...)
+	}
+	problems := map[string][]DoctorProblem{}
+	fixes := map[DoctorProblem]func() error{}
+	for _, finding := range findings {
+		assert.NotEmpty(t, doctorExplanations[finding.Problem], finding.Problem)
+		problems[finding.Path] = append(problems[finding.Path], finding.Problem)
+		fixes[finding.Problem] = finding.fix
+	}
+
+	assert.Equal(t, map[string][]DoctorProblem{
+		".git/modules/old": {DoctorOrphanedModule},
+		"tools/api":        {DoctorUnregisteredDir},
+		"api":              {DoctorMissingOriginHead, DoctorDetachedHead},
+		"lib":              {DoctorDefaultBranchFailed},
+	}, problems)
+	assert.Nil(t, fixes[DoctorDetachedHead]) // restore and at detach on purpose
+	assert.Nil(t, fixes[DoctorDefaultBranchFailed])
+
+	assert.NoError(t, fixes[DoctorMissingOriginHead]())
+	assert.Equal(t, "origin/main", mustGit(t, apiPath, "symbolic-ref", "--short", "refs/remotes/origin/HEAD"))
+}
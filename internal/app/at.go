@@ -0,0 +1,226 @@
+package app
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// atBranchConfigKey - git config key with the branch which was checked out before CheckoutSubmodulesAt,
+// it also marks repos detached by CheckoutSubmodulesAt for ReturnSubmodulesToBranches
+const atBranchConfigKey = "mpcreator.atbranch"
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses timestamp e.g. "2026-09-01", "2026-09-01 12:00", "2026-09-01T12:00:00+03:00".
+// Timestamps without time zone are in local time.
+func ParseTime(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("unexpected timestamp %q, expected one of %v", s, timeLayouts)
+}
+
+// AtOutcome - result of checkoutSubmoduleAt / returnSubmoduleToBranch
+type AtOutcome string
+
+const (
+	AtOutcomeCheckedOut   AtOutcome = "checked-out"
+	AtOutcomeAlready      AtOutcome = "already"
+	AtOutcomeMissing      AtOutcome = "missing" // no commits on the default branch before the time
+	AtOutcomeReturned     AtOutcome = "returned"
+	AtOutcomeNotAt        AtOutcome = "not-at" // detached not by at (e.g. by restore), left alone
+	AtOutcomeSkippedDirty AtOutcome = "skipped-dirty"
+	AtOutcomeFailed       AtOutcome = "failed"
+)
+
+// CheckoutSubmodulesAt checks out (detached HEAD) the last commit of the default branch at or before the time
+// in all selected submodules. Current branches are remembered for ReturnSubmodulesToBranches.
+func (a *App) CheckoutSubmodulesAt(filter Filter, at time.Time) (err error) {
+	a.log.With(
+		"filter", filter,
+		"at", at,
+	).Info("CheckoutSubmodulesAt")
+
+	return a.forEachSubmoduleAt(filter, "CheckoutSubmodulesAt", func(submodule *git.Submodule) (AtOutcome, error) {
+		return a.checkoutSubmoduleAt(submodule, at, a.log)
+	})
+}
+
+// ReturnSubmodulesToBranches switches selected submodules detached by CheckoutSubmodulesAt
+// back to the branches they were on (or to the default branch)
+func (a *App) ReturnSubmodulesToBranches(filter Filter) (err error) {
+	a.log.With("filter", filter).Info("ReturnSubmodulesToBranches")
+
+	return a.forEachSubmoduleAt(filter, "ReturnSubmodulesToBranches", func(submodule *git.Submodule) (AtOutcome, error) {
+		return a.returnSubmoduleToBranch(submodule, a.log)
+	})
+}
+
+func (a *App) forEachSubmoduleAt(filter Filter, name string, action func(submodule *git.Submodule) (AtOutcome, error)) (err error) {
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	outcomes := map[AtOutcome][]string{}
+	for _, submodule := range submodules {
+		outcome, err := action(submodule)
+		if err != nil {
+			outcome = AtOutcomeFailed
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to " + name)
+		}
+		outcomes[outcome] = append(outcomes[outcome], submodule.Config().Path)
+	}
+
+	for _, outcome := range []AtOutcome{AtOutcomeSkippedDirty, AtOutcomeMissing, AtOutcomeNotAt} {
+		if len(outcomes[outcome]) == 0 {
+			continue
+		}
+		sort.Strings(outcomes[outcome])
+		a.log.With("reason", outcome, "submodules", outcomes[outcome]).Warn("submodules left alone")
+	}
+
+	counts := make(map[AtOutcome]int, len(outcomes))
+	for outcome, paths := range outcomes {
+		counts[outcome] = len(paths)
+	}
+	a.log.With("outcomes", counts).Info(name + " done")
+
+	return nil
+}
+
+func (a *App) checkoutSubmoduleAt(submodule *git.Submodule, at time.Time, log *zap.SugaredLogger) (outcome AtOutcome, err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	log.Debug("checking out submodule at time...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("checking out submodule at time done")
+		}
+	}()
+
+	repoPath := a.getSubmodulePath(submodule)
+
+	_, err = runGit(repoPath, "fetch", "origin")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch")
+	}
+
+	submoduleDefaultBranch, err := a.getSubmoduleDefaultBranch(submodule)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+	}
+	log = log.With("submoduleDefaultBranch", submoduleDefaultBranch)
+
+	// --first-parent - commits of the default branch itself, not of the merged branches
+	commit, err := runGit(repoPath, "rev-list", "-1", "--first-parent",
+		"--before="+at.Format(time.RFC3339), "origin/"+submoduleDefaultBranch)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-list")
+	}
+	if commit == "" {
+		if isShallowOrPartial(repoPath) {
+			log.Warn("shallow clone may not contain commits before the time, see deepen command")
+		}
+		return AtOutcomeMissing, nil
+	}
+	log = log.With("commit", commit)
+
+	head, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+	if head == commit {
+		return AtOutcomeAlready, nil
+	}
+
+	dirty, err := isWorktreeDirty(repoPath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to isWorktreeDirty")
+	}
+	if dirty {
+		return AtOutcomeSkippedDirty, nil
+	}
+
+	// remember the branch only when leaving it, repeated checkouts keep the original one.
+	// Repo detached before (e.g. by restore) is returned to the default branch.
+	branch, _ := runGit(repoPath, "symbolic-ref", "-q", "--short", "HEAD")
+	if branch == "" {
+		branch, _ = runGit(repoPath, "config", "--get", atBranchConfigKey)
+	}
+	if branch == "" {
+		branch, err = a.getSubmoduleDefaultBranch(submodule)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+		}
+	}
+	_, err = runGit(repoPath, "config", atBranchConfigKey, branch)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to set %s", atBranchConfigKey)
+	}
+
+	_, err = runGit(repoPath, "switch", "--detach", commit)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to switch --detach")
+	}
+
+	return AtOutcomeCheckedOut, nil
+}
+
+func (a *App) returnSubmoduleToBranch(submodule *git.Submodule, log *zap.SugaredLogger) (outcome AtOutcome, err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	log.Debug("returning submodule to branch...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("returning submodule to branch done")
+		}
+	}()
+
+	repoPath := a.getSubmodulePath(submodule)
+
+	currentBranch, _ := runGit(repoPath, "symbolic-ref", "-q", "--short", "HEAD")
+	if currentBranch != "" {
+		return AtOutcomeAlready, nil
+	}
+
+	branch, _ := runGit(repoPath, "config", "--get", atBranchConfigKey)
+	if branch == "" { // not detached by at
+		return AtOutcomeNotAt, nil
+	}
+	log = log.With("branch", branch)
+
+	dirty, err := isWorktreeDirty(repoPath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to isWorktreeDirty")
+	}
+	if dirty {
+		return AtOutcomeSkippedDirty, nil
+	}
+
+	_, err = runGit(repoPath, "switch", branch)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to switch")
+	}
+	_, _ = runGit(repoPath, "config", "--unset", atBranchConfigKey) // missing key is not an error
+
+	return AtOutcomeReturned, nil
+}
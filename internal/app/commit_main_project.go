@@ -0,0 +1,179 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gitlinkMode - git file mode of submodule entries (gitlinks)
+const gitlinkMode = "160000"
+
+// gitlinkChange - change of the submodule commit recorded in the main project
+type gitlinkChange struct {
+	Path      string
+	OldCommit string // "" for added submodules
+	NewCommit string // "" for removed submodules
+	Commits   string // number of new commits for updated submodules, "" if unknown
+}
+
+// parseGitlinkChanges parses gitlink changes from "git diff --raw --no-abbrev" output
+func parseGitlinkChanges(rawDiff string) (changes []gitlinkChange) {
+	const zeroCommit = "0000000000000000000000000000000000000000"
+
+	for _, line := range strings.Split(rawDiff, "\n") {
+		// :160000 160000 <old> <new> M\tpath
+		meta, changePath, found := strings.Cut(line, "\t")
+		fields := strings.Fields(strings.TrimPrefix(meta, ":"))
+		if !found || len(fields) != 5 {
+			continue
+		}
+		oldMode, newMode, oldCommit, newCommit := fields[0], fields[1], fields[2], fields[3]
+		if oldMode != gitlinkMode && newMode != gitlinkMode {
+			continue
+		}
+
+		change := gitlinkChange{Path: changePath}
+		if oldMode == gitlinkMode && oldCommit != zeroCommit {
+			change.OldCommit = oldCommit
+		}
+		if newMode == gitlinkMode && newCommit != zeroCommit {
+			change.NewCommit = newCommit
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// formatCommitMessage returns message of the main project commit e.g.
+//
+//	mpcreator pull: 1 added, 2 updated
+//
+//	Added:
+//	  platform/web 5850b12
+//	Updated:
+//	  platform/api 3cb6531..b02efdd (+2 commits)
+//	  platform/billing a1c913f..5850b12
+func formatCommitMessage(command string, changes []gitlinkChange) (message string) {
+	var added, updated, removed []string
+	for _, change := range changes {
+		switch {
+		case change.OldCommit == "":
+			added = append(added, fmt.Sprintf("  %s %s", change.Path, shortCommit(change.NewCommit)))
+		case change.NewCommit == "":
+			removed = append(removed, "  "+change.Path)
+		default:
+			line := fmt.Sprintf("  %s %s..%s", change.Path, shortCommit(change.OldCommit), shortCommit(change.NewCommit))
+			if change.Commits != "" {
+				line += " (+" + change.Commits + " commits)"
+			}
+			updated = append(updated, line)
+		}
+	}
+
+	var summary []string
+	b := &strings.Builder{}
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{
+		{"added", added},
+		{"updated", updated},
+		{"removed", removed},
+	} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		summary = append(summary, fmt.Sprintf("%d %s", len(section.lines), section.title))
+		fmt.Fprintf(b, "\n%s:\n%s", strings.ToUpper(section.title[:1])+section.title[1:], strings.Join(section.lines, "\n"))
+	}
+	if len(summary) == 0 {
+		return fmt.Sprintf("mpcreator %s: update %s\n", command, gitmodulesFile)
+	}
+
+	return fmt.Sprintf("mpcreator %s: %s\n%s\n", command, strings.Join(summary, ", "), b.String())
+}
+
+// commitMainProject commits .gitmodules and the selected submodules (gitlinks) of the main project,
+// other changes of the main project (including other submodules) are not committed.
+// Nothing is committed if there are no changes.
+func (a *App) commitMainProject(command string, selectedPaths []string) (err error) {
+	mainProjectRepo, err := a.openMainProject()
+	if err != nil {
+		return errors.Wrap(err, "failed to openMainProject")
+	}
+	wt, err := mainProjectRepo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "failed to mainProjectRepo.Worktree")
+	}
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return errors.Wrap(err, "failed to wt.Submodules")
+	}
+	if len(submodules) == 0 {
+		return nil
+	}
+
+	selected := make(map[string]struct{}, len(selectedPaths))
+	for _, selectedPath := range selectedPaths {
+		selected[selectedPath] = struct{}{}
+	}
+
+	paths := []string{gitmodulesFile}
+	for _, submodule := range submodules {
+		if _, ok := selected[submodule.Config().Path]; !ok {
+			continue
+		}
+		if _, err = os.Stat(a.getSubmodulePath(submodule)); err != nil { // not cloned
+			continue
+		}
+		paths = append(paths, submodule.Config().Path)
+	}
+
+	_, err = runGit(a.mainProjectPath, append([]string{"add", "--"}, paths...)...)
+	if err != nil {
+		return errors.Wrap(err, "failed to add")
+	}
+
+	rawDiff, err := runGit(a.mainProjectPath, append([]string{"diff", "--cached", "--raw", "--no-abbrev", "--"}, paths...)...)
+	if err != nil {
+		return errors.Wrap(err, "failed to diff")
+	}
+	if rawDiff == "" {
+		a.log.Info("main project has no changes to commit")
+		return nil
+	}
+
+	changes := parseGitlinkChanges(rawDiff)
+	for i, change := range changes {
+		if change.OldCommit == "" || change.NewCommit == "" {
+			continue
+		}
+		changes[i].Commits, _ = runGit(
+			a.mainProjectPath+"/"+change.Path,
+			"rev-list", "--count", change.OldCommit+".."+change.NewCommit,
+		)
+	}
+	message := formatCommitMessage(command, changes)
+
+	// only .gitmodules and submodules, even if something else is staged
+	_, err = runGit(a.mainProjectPath, append([]string{"commit", "-m", message, "--"}, paths...)...)
+	if err != nil {
+		return errors.Wrap(err, "failed to commit")
+	}
+	a.log.With("submodules", len(changes)).Info("main project committed")
+
+	return nil
+}
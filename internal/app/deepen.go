@@ -0,0 +1,95 @@
+package app
+
+import (
+	"strconv"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DeepenOptions - options for DeepenSubmodules
+type DeepenOptions struct {
+	By          int  // deepen history by this number of commits, 0 - fetch full history (unshallow)
+	AllBranches bool // fetch all branches for single-branch clones
+	Unfilter    bool // fetch all missing objects of partial clones and disable the filter
+}
+
+// DeepenSubmodules fetches history (and objects) missing in shallow / single-branch / partial clones
+// of the selected submodules (see CloneOptions)
+func (a *App) DeepenSubmodules(filter Filter, opts DeepenOptions) (err error) {
+	a.log.With(
+		"filter", filter,
+		"opts", opts,
+	).Info("DeepenSubmodules")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	for _, submodule := range submodules {
+		err = a.deepenSubmodule(submodule, opts, a.log)
+		if err != nil {
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to deepenSubmodule")
+
+			continue
+		}
+	}
+
+	return nil
+}
+
+func (a *App) deepenSubmodule(submodule *git.Submodule, opts DeepenOptions, log *zap.SugaredLogger) (err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	repoPath := a.getSubmodulePath(submodule)
+
+	if opts.AllBranches {
+		_, err = runGit(repoPath, "remote", "set-branches", "origin", "*")
+		if err != nil {
+			return errors.Wrap(err, "failed to remote set-branches")
+		}
+	}
+
+	args := []string{"fetch", "origin"}
+	shallow, err := runGit(repoPath, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return errors.Wrap(err, "failed to rev-parse --is-shallow-repository")
+	}
+	if shallow == "true" {
+		if opts.By > 0 {
+			args = append(args, "--deepen="+strconv.Itoa(opts.By))
+		} else {
+			args = append(args, "--unshallow")
+		}
+	}
+
+	if opts.Unfilter {
+		promisor, _ := runGit(repoPath, "config", "--get", "remote.origin.promisor")
+		if promisor == "true" {
+			for _, key := range []string{"remote.origin.promisor", "remote.origin.partialclonefilter"} {
+				_, err = runGit(repoPath, "config", "--unset", key)
+				if err != nil {
+					return errors.Wrapf(err, "failed to unset %s", key)
+				}
+			}
+			args = append(args, "--refetch")
+		}
+	}
+
+	if len(args) == 2 && !opts.AllBranches {
+		log.Debug("nothing to deepen")
+		return nil
+	}
+
+	_, err = runGit(repoPath, args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch")
+	}
+	log.With("fetchArgs", args[2:]).Info("submodule deepened")
+
+	return nil
+}
@@ -0,0 +1,270 @@
+package app
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DoctorProblem - known broken state of the main project or submodule
+type DoctorProblem string
+
+const (
+	DoctorUnregisteredDir     DoctorProblem = "unregistered-dir"
+	DoctorOrphanedModule      DoctorProblem = "orphaned-module"
+	DoctorNotCloned           DoctorProblem = "not-cloned"
+	DoctorMissingOriginHead   DoctorProblem = "missing-origin-head"
+	DoctorMissingTracking     DoctorProblem = "missing-tracking-branch"
+	DoctorTrackingOutOfSync   DoctorProblem = "tracking-branch-out-of-sync"
+	DoctorURLMismatch         DoctorProblem = "url-mismatch"
+	DoctorUnavailableGitlink  DoctorProblem = "unavailable-gitlink"
+	DoctorDetachedHead        DoctorProblem = "detached-head"
+	DoctorDefaultBranchFailed DoctorProblem = "default-branch-unknown"
+)
+
+// doctorExplanations - what the problem means and how to fix it manually
+var doctorExplanations = map[DoctorProblem]string{
+	DoctorUnregisteredDir: "directory contains a git repo but isn't registered as submodule: " +
+		"fill absorbs it if it is a clone of the gitlab project, otherwise move it out of the main project",
+	DoctorOrphanedModule: "git dir in .git/modules has no submodule in .gitmodules (submodule was removed or renamed), " +
+		"it may contain unpushed branches - check them and remove the dir manually",
+	DoctorNotCloned: "submodule is registered but not cloned, fix: git submodule update --init",
+	DoctorMissingOriginHead: "refs/remotes/origin/HEAD is missing, default branch can't be determined locally " +
+		"(pull, switch, reset-to-default), fix: git remote set-head origin <default branch>",
+	DoctorMissingTracking: "tracking branch from .gitmodules doesn't exist on origin (renamed or removed), " +
+		"pull skips the submodule - run fill to refresh tracking branches from gitlab",
+	DoctorTrackingOutOfSync: "tracking branch in .git/config differs from .gitmodules, fix: copy it from .gitmodules",
+	DoctorURLMismatch: "url differs in .gitmodules, .git/config and origin remote, " +
+		"fix it with remap-remotes or fill --doctor-remotes fix",
+	DoctorUnavailableGitlink: "commit recorded in the main project is missing in the submodule, " +
+		"fix: git fetch origin (if it is still missing the commit was never pushed)",
+	DoctorDetachedHead: "HEAD is detached (e.g. after git submodule update, restore or at), pull skips the submodule, " +
+		"it may be on purpose: repos detached by at are returned with at --back, others - git switch <branch>",
+	DoctorDefaultBranchFailed: "default branch can't be determined neither locally nor from gitlab / origin, " +
+		"pull skips submodules without tracking branch - check access to the remote",
+}
+
+// doctorFinding - problem found by Doctor
+type doctorFinding struct {
+	Path    string
+	Problem DoctorProblem
+	Details string
+	fix     func() (err error) // nil if there is no safe fix
+}
+
+// Doctor scans the main project and the selected submodules for known problems, explains them
+// and (if fix) fixes the safe ones
+func (a *App) Doctor(filter Filter, fix bool) (err error) {
+	a.log.With(
+		"filter", filter,
+		"fix", fix,
+	).Info("Doctor")
+
+	mainProjectRepo, err := a.openMainProject()
+	if err != nil {
+		return errors.Wrap(err, "failed to openMainProject")
+	}
+	wt, err := mainProjectRepo.Worktree()
+	if err != nil {
+		return errors.Wrap(err, "failed to mainProjectRepo.Worktree")
+	}
+	allSubmodules, err := wt.Submodules()
+	if err != nil {
+		return errors.Wrap(err, "failed to wt.Submodules")
+	}
+
+	findings, err := a.diagnoseMainProject(filter, allSubmodules)
+	if err != nil {
+		return errors.Wrap(err, "failed to diagnoseMainProject")
+	}
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+	for _, submodule := range submodules {
+		findings = append(findings, a.diagnoseSubmodule(submodule)...)
+	}
+
+	counts := map[DoctorProblem]int{}
+	fixed, fixable := 0, 0
+	for _, finding := range findings {
+		counts[finding.Problem]++
+		log := a.log.With(
+			"path", finding.Path,
+			"problem", finding.Problem,
+		)
+		if finding.Details != "" {
+			log = log.With("details", finding.Details)
+		}
+		log.With("explanation", doctorExplanations[finding.Problem], "fixable", finding.fix != nil).Warn("problem found")
+
+		if finding.fix == nil {
+			continue
+		}
+		fixable++
+		if !fix {
+			continue
+		}
+		err = finding.fix()
+		if err != nil {
+			log.With("error", err.Error()).Error("failed to fix")
+			continue
+		}
+		fixed++
+		log.Info("fixed")
+	}
+
+	if fixable != 0 && !fix {
+		a.log.With("fixable", fixable).Info("run doctor with --fix to fix the safe problems")
+	}
+	a.log.With("problems", counts, "fixed", fixed).Info("Doctor done")
+
+	return nil
+}
+
+// diagnoseMainProject finds unregistered repos in the main project dirs and orphaned dirs in .git/modules
+func (a *App) diagnoseMainProject(filter Filter, allSubmodules git.Submodules) (findings []doctorFinding, err error) {
+	paths, names := map[string]struct{}{}, map[string]struct{}{}
+	for _, submodule := range allSubmodules {
+		paths[submodule.Config().Path] = struct{}{}
+		names[submodule.Config().Name] = struct{}{}
+	}
+
+	root := filepath.Clean(a.mainProjectPath)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		relPath := filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator)))
+		if _, ok := paths[relPath]; ok {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err == nil {
+			if filter.fullPathPass(relPath) {
+				findings = append(findings, doctorFinding{Path: relPath, Problem: DoctorUnregisteredDir})
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk main project")
+	}
+
+	modulesDir := filepath.Join(root, ".git", "modules")
+	err = filepath.WalkDir(modulesDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == modulesDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == modulesDir {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(path, "HEAD")); err != nil {
+			return nil // not a git dir yet, names can contain "/"
+		}
+		name := filepath.ToSlash(strings.TrimPrefix(path, modulesDir+string(filepath.Separator)))
+		if _, ok := names[name]; !ok && filter.fullPathPass(name) {
+			findings = append(findings, doctorFinding{Path: ".git/modules/" + name, Problem: DoctorOrphanedModule})
+		}
+		return filepath.SkipDir // nested submodules are in <gitdir>/modules
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Wrap(err, "failed to walk .git/modules")
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Path < findings[j].Path })
+
+	return findings, nil
+}
+
+// diagnoseSubmodule finds problems of the submodule (including the ones pullSubmodule fails with)
+func (a *App) diagnoseSubmodule(submodule *git.Submodule) (findings []doctorFinding) {
+	subPath := submodule.Config().Path
+	repoPath := a.getSubmodulePath(submodule)
+	log := a.log.With("submodule", subPath)
+	add := func(problem DoctorProblem, details string, fix func() (err error)) {
+		findings = append(findings, doctorFinding{Path: subPath, Problem: problem, Details: details, fix: fix})
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+		add(DoctorNotCloned, "", func() (err error) {
+			_, err = runGit(a.mainProjectPath, "submodule", "update", "--init", "--", subPath)
+			return err
+		})
+		return findings
+	}
+
+	urls, err := a.getSubmoduleURLs(submodule)
+	if err != nil {
+		log.With(zap.Error(err)).Error("failed to getSubmoduleURLs")
+	} else if distinct := urls.distinct(); len(distinct) > 1 {
+		add(DoctorURLMismatch, strings.Join(distinct, " "), nil)
+	}
+
+	key := "submodule." + submodule.Config().Name + ".branch"
+	gitmodulesBranch, _ := runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, "--get", key)
+	configBranch, _ := runGit(a.mainProjectPath, "config", "--get", key)
+	if gitmodulesBranch != "" && configBranch != gitmodulesBranch {
+		add(DoctorTrackingOutOfSync, configBranch+" != "+gitmodulesBranch, func() (err error) {
+			_, err = runGit(a.mainProjectPath, "config", key, gitmodulesBranch)
+			return err
+		})
+	}
+	if gitmodulesBranch != "" {
+		if _, err = runGit(repoPath, "show-ref", "--verify", "-q", "refs/remotes/origin/"+gitmodulesBranch); err != nil {
+			add(DoctorMissingTracking, gitmodulesBranch, nil)
+		}
+	}
+
+	if _, err = runGit(repoPath, "symbolic-ref", "-q", "refs/remotes/origin/HEAD"); err != nil {
+		if _, err = a.resolveSubmoduleDefaultBranch(submodule); err != nil {
+			add(DoctorDefaultBranchFailed, err.Error(), nil)
+		} else {
+			add(DoctorMissingOriginHead, "", func() (err error) {
+				_, err = a.repairSubmoduleOriginHead(submodule, a.log)
+				return err
+			})
+		}
+	}
+
+	// "160000 <commit> 0\t<path>", empty for not committed submodules
+	gitlink, _ := runGit(a.mainProjectPath, "ls-files", "-s", "--", subPath)
+	if fields := strings.Fields(gitlink); len(fields) >= 2 && fields[0] == gitlinkMode {
+		commit := fields[1]
+		if _, err = runGit(repoPath, "cat-file", "-e", commit+"^{commit}"); err != nil {
+			add(DoctorUnavailableGitlink, commit, func() (err error) {
+				_, err = runGit(repoPath, "fetch", "origin")
+				if err != nil {
+					return errors.Wrap(err, "failed to fetch")
+				}
+				_, err = runGit(repoPath, "cat-file", "-e", commit+"^{commit}")
+				if err != nil {
+					return errors.Errorf("commit %s is not available on origin, it was never pushed", commit)
+				}
+				return nil
+			})
+		}
+	}
+
+	if branch, _ := runGit(repoPath, "symbolic-ref", "-q", "--short", "HEAD"); branch == "" {
+		add(DoctorDetachedHead, "", nil) // restore and at detach on purpose, there is no safe fix
+	}
+
+	return findings
+}
@@ -1,27 +1,143 @@
 package app
 
 import (
-	"bytes"
 	"os"
-	"os/exec"
+	"path"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/pkg/errors"
 	"github.com/xanzy/go-gitlab"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// Sources - additional (not group based) sources of projects for FillMainProject
+type Sources struct {
+	Owned    bool   // projects from the current user namespace
+	Starred  bool   // projects starred by the current user
+	Shared   *bool  // projects shared with the iterated groups from other namespaces, nil - gitlab default (included)
+	UsersDir string // directory (relative to main project) for projects from user namespaces
+
+	Archived ArchivedMode
+
+	// Manifest - local manifest (yaml, toml or xml) with repos added besides gitlab projects,
+	// they can be hosted anywhere e.g. public github or a vendor's git server
+	Manifest string
+}
+
+// ArchivedMode - how to handle archived projects
+type ArchivedMode string
+
+const (
+	ArchivedExclude ArchivedMode = "exclude"
+	ArchivedInclude ArchivedMode = "include"
+	ArchivedOnly    ArchivedMode = "only"
+)
+
+// ArchiveDir - directory (relative to main project) for archived projects,
+// they are stored separately because they are read-only and pull skips them
+const ArchiveDir = "_archive"
+
+// archivedOption returns value for gitlab "archived" list option
+func (s Sources) archivedOption() (archived *bool) {
+	switch s.Archived {
+	case ArchivedInclude:
+		return nil
+	case ArchivedOnly:
+		return pointerToVar(true)
+	default:
+		return pointerToVar(false)
+	}
+}
+
+// DefaultUsersDir - default Sources.UsersDir
+const DefaultUsersDir = "users"
+
+// ForksMode - how to handle forked projects
+type ForksMode string
+
+const (
+	ForksInclude ForksMode = "include"
+	ForksExclude ForksMode = "exclude"
+	ForksOnly    ForksMode = "only"
+)
+
+// MirrorsMode - how to handle pull-mirror projects
+type MirrorsMode string
+
+const (
+	MirrorsInclude MirrorsMode = "include"
+	MirrorsExclude MirrorsMode = "exclude"
+)
+
+// Kinds - filters projects by kind (fork / mirror)
+type Kinds struct {
+	Forks   ForksMode
+	Mirrors MirrorsMode
+
+	Upstream bool // add "upstream" remote pointing to ForkedFromProject for cloned forks
+}
+
+// pass returns false if project should be skipped because of it's kind
+func (k Kinds) pass(project *gitlab.Project) (pass bool) {
+	isFork := project.ForkedFromProject != nil
+
+	switch k.Forks {
+	case ForksExclude:
+		if isFork {
+			return false
+		}
+	case ForksOnly:
+		if !isFork {
+			return false
+		}
+	}
+
+	if k.Mirrors == MirrorsExclude && project.Mirror {
+		return false
+	}
+
+	return true
+}
+
+// projectPath returns path of project submodule relative to main project
+func (s Sources) projectPath(project *gitlab.Project) (projectPath string) {
+	projectPath = strings.ReplaceAll(project.PathWithNamespace, " / ", "/")
+	if project.Namespace != nil && project.Namespace.Kind == "user" {
+		usersDir := s.UsersDir
+		if usersDir == "" {
+			usersDir = DefaultUsersDir
+		}
+		projectPath = path.Join(usersDir, projectPath)
+	}
+	if project.Archived {
+		projectPath = path.Join(ArchiveDir, projectPath)
+	}
+	return projectPath
+}
+
 func (a *App) FillMainProject(
-	includeGroups, excludeGroups,
-	includeProjects, excludeProjects,
-	includeLanguages, excludeLanguages []string,
+	filter Filter,
+	sources Sources,
+	kinds Kinds,
+	sizeLimit SizeLimit,
+	cloneOpts CloneOptions,
+	remotesCheck RemotesCheck, // check remotes of existing submodules against gitlab projects
+	commit bool, // commit .gitmodules and added submodules to the main project at the end
+	reportOpts ReportOptions,
 ) (err error) {
 	a.log.With(
-		"includeGroups", includeGroups, "excludeGroups", excludeGroups,
-		"includeProjects", includeProjects, "excludeProjects", excludeProjects,
-		"includeLanguages", includeLanguages, "excludeLanguages", excludeLanguages,
+		"filter", filter,
+		"sources", sources, "kinds", kinds, "sizeLimit", sizeLimit,
+		"cloneOpts", cloneOpts,
+		"remotesCheck", remotesCheck,
+		"commit", commit,
+		"reportOpts", reportOpts,
 	).Info("FillMainProject")
 
 	mainProjectRepo, err := a.initMainProject()
@@ -29,31 +145,128 @@ func (a *App) FillMainProject(
 		return errors.Wrap(err, "failed to initMainProject")
 	}
 
-	err = a.iterateGroups(func(group *gitlab.Group) (err error) {
-		log := a.log.With("group", group.FullPath)
-		log.Debug("filling group ...")
+	report := newSizeReport()
+	var listOptions []gitlab.RequestOptionFunc
+	if sizeLimit.needStatistics() {
+		listOptions = append(listOptions, withStatistics())
+	}
+	results := newRunReport("fill")
+	var gitmodulesMu sync.Mutex // git config can't be written concurrently
 
-		g := &errgroup.Group{}
+	// existing submodules of renamed / moved projects are found by project ID, not by the new path
+	submodulesByID := &projectSubmodules{app: a, mainProjectRepo: mainProjectRepo, gitmodulesMu: &gitmodulesMu}
+
+	// the same project can be found several times (shared with several groups, starred)
+	foundProjects := map[int]struct{}{}
+	fillProject := func(g *errgroup.Group, log *zap.SugaredLogger) func(project *gitlab.Project) (err error) {
+		return func(project *gitlab.Project) (err error) {
+			if _, ok := foundProjects[project.ID]; ok {
+				return nil
+			}
+			foundProjects[project.ID] = struct{}{}
+
+			if !kinds.pass(project) {
+				return nil
+			}
 
-		err = a.iterateGroupProjects(group, func(project *gitlab.Project) (err error) {
 			g.Go(func() (err error) {
 				log := log.With("project", project.PathWithNamespace)
 				log.Debug("filling project ...")
 				defer log.Debug("filling project done")
 
-				projectPath := strings.ReplaceAll(project.PathWithNamespace, " / ", "/")
-				_, err = addSubmoduleToRepo(mainProjectRepo, projectPath, project.SSHURLToRepo, log)
+				started := time.Now()
+				projectPath := sources.projectPath(project)
+				details := ""
+				moved := false
+				if remotesCheck != RemotesCheckOff && remotesCheck != "" {
+					oldPath, err := submodulesByID.movedPath(project.ID, projectPath)
+					if err != nil {
+						log.With(zap.Error(err)).Warn("failed to find submodule of the project by id")
+					}
+					if oldPath != "" {
+						// the existing submodule is checked instead of cloning a second copy at the new path
+						log.With("submodulePath", oldPath, "projectPath", projectPath).
+							Warn("project is moved, submodule stays at the old path, move it with git mv")
+						details = "project moved to " + projectPath
+						projectPath, moved = oldPath, true
+					}
+				}
+				cloneOpts := cloneOpts
+				var repoSize int64
+				if sizeLimit.needStatistics() && !moved {
+					repoSize, err = a.getProjectRepoSize(project)
+					if err != nil {
+						log.With(zap.Error(err)).Warn("failed to getProjectRepoSize")
+					}
+				}
+				if sizeLimit.MaxRepoSize > 0 && repoSize > sizeLimit.MaxRepoSize {
+					log := log.With("repoSize", formatSize(repoSize))
+					switch sizeLimit.LargeRepos {
+					case LargeReposShallow:
+						log.Info("repo is too large, cloning shallow")
+						cloneOpts.Depth = 1
+						details = "repo is too large (" + formatSize(repoSize) + "), cloned shallow"
+					default:
+						log.Info("repo is too large, skipping")
+						results.add(projectPath, ReportStatusSkipped, "repo is too large ("+formatSize(repoSize)+")", nil, started)
+						return nil
+					}
+				}
+
+				// stepErr - error after the submodule is added, the first one goes to the report
+				submodule, added, stepErr, err := a.addProjectSubmodule(
+					mainProjectRepo, &gitmodulesMu,
+					projectPath, project.SSHURLToRepo, project.DefaultBranch, project.LFSEnabled,
+					cloneOpts, log,
+				)
 				if err != nil {
-					log.With(zap.Error(err)).Error("failed to addSubmoduleToRepo")
+					log.With(zap.Error(err)).Error("failed to addProjectSubmodule")
+					results.add(projectPath, ReportStatusFailed, "", errors.Wrap(err, "failed to addProjectSubmodule"), started)
+					return nil
 				}
+				status := ReportStatusExisted
+				if added {
+					status = ReportStatusAdded
+					namespace := ""
+					if project.Namespace != nil {
+						namespace = project.Namespace.FullPath
+					}
+					report.add(namespace, repoSize)
+				} else {
+					err = a.checkProjectRemote(submodule, project, remotesCheck, &gitmodulesMu, log)
+					if err != nil {
+						log.With(zap.Error(err)).Error("failed to checkProjectRemote")
+						if stepErr == nil {
+							stepErr = errors.Wrap(err, "failed to checkProjectRemote")
+						}
+					}
+				}
+
+				if kinds.Upstream && project.ForkedFromProject != nil {
+					err = a.addUpstreamRemote(submodule, project.ForkedFromProject)
+					if err != nil {
+						log.With(zap.Error(err)).Error("failed to addUpstreamRemote")
+						if stepErr == nil {
+							stepErr = errors.Wrap(err, "failed to addUpstreamRemote")
+						}
+					}
+				}
+
+				results.add(projectPath, status, details, stepErr, started)
 				return nil
 			})
 
 			return nil
-		},
-			includeProjects, excludeProjects,
-			includeLanguages, excludeLanguages,
-		)
+		}
+	}
+
+	err = a.iterateGroups(func(group *gitlab.Group) (err error) {
+		log := a.log.With("group", group.FullPath)
+		log.Debug("filling group ...")
+
+		g := &errgroup.Group{}
+
+		err = a.iterateGroupProjects(group, fillProject(g, log), sources, filter, listOptions...)
 		if err != nil {
 			return errors.Wrap(err, "failed to iterateGroupProjects")
 		}
@@ -64,12 +277,60 @@ func (a *App) FillMainProject(
 		}
 
 		return nil
-	}, includeGroups, excludeGroups)
+	}, filter)
 	if err != nil {
 		return errors.Wrap(err, "failed to iterateGroups")
 	}
 
-	return nil
+	if sources.Owned || sources.Starred {
+		a.log.Debug("filling user projects ...")
+
+		g := &errgroup.Group{}
+
+		err = a.iterateUserProjects(fillProject(g, a.log), sources, filter, listOptions...)
+		if err != nil {
+			return errors.Wrap(err, "failed to iterateUserProjects")
+		}
+
+		err = g.Wait()
+		if err != nil {
+			return errors.Wrap(err, "failed to g.Wait")
+		}
+	}
+
+	if sources.Manifest != "" {
+		a.log.With("manifest", sources.Manifest).Debug("filling manifest projects ...")
+
+		manifest, err := readManifest(sources.Manifest)
+		if err != nil {
+			return errors.Wrap(err, "failed to readManifest")
+		}
+		err = a.fillManifestProjects(mainProjectRepo, manifest, filter, cloneOpts, results)
+		if err != nil {
+			return errors.Wrap(err, "failed to fillManifestProjects")
+		}
+	}
+
+	err = results.finish(os.Stdout, reportOpts)
+	if err != nil {
+		return errors.Wrap(err, "failed to finish run report")
+	}
+
+	if sizeLimit.Report {
+		err = report.print(os.Stdout)
+		if err != nil {
+			return errors.Wrap(err, "failed to print size report")
+		}
+	}
+
+	if commit {
+		err = a.commitMainProject("fill", results.paths())
+		if err != nil {
+			return errors.Wrap(err, "failed to commitMainProject")
+		}
+	}
+
+	return results.check(reportOpts.FailOn)
 }
 
 func (a *App) initMainProject() (mainProjectRepo *git.Repository, err error) {
@@ -103,9 +364,7 @@ func (a *App) initMainProject() (mainProjectRepo *git.Repository, err error) {
 func (a *App) iterateGroupsProjects(
 	groupCallback func(group *gitlab.Group) (err error),
 	projectCallback func(project *gitlab.Project) (err error),
-	includeGroups, excludeGroups,
-	includeProjects, excludeProjects,
-	includeLanguages, excludeLanguages []string,
+	filter Filter,
 ) (err error) {
 	err = a.iterateGroups(func(group *gitlab.Group) (err error) {
 		if groupCallback != nil {
@@ -115,17 +374,13 @@ func (a *App) iterateGroupsProjects(
 			}
 		}
 		if projectCallback != nil {
-			err = a.iterateGroupProjects(
-				group, projectCallback,
-				includeProjects, excludeProjects,
-				includeLanguages, excludeLanguages,
-			)
+			err = a.iterateGroupProjects(group, projectCallback, Sources{}, filter)
 			if err != nil {
 				return errors.Wrap(err, "failed to iterateGroupProjects")
 			}
 		}
 		return nil
-	}, includeGroups, excludeGroups)
+	}, filter)
 	if err != nil {
 		return errors.Wrap(err, "failed to iterateGroups")
 	}
@@ -134,11 +389,11 @@ func (a *App) iterateGroupsProjects(
 
 func (a *App) iterateGroups(
 	groupCallback func(group *gitlab.Group) (err error),
-	include, exclude []string,
+	filter Filter,
 ) (err error) {
 	var search *string
-	if len(include) == 1 {
-		search = pointerToVar(include[0])
+	if len(filter.IncludeGroups) == 1 {
+		search = pointerToVar(filter.IncludeGroups[0])
 	}
 
 	for page, perPage := 1, 100; ; page++ {
@@ -156,7 +411,7 @@ func (a *App) iterateGroups(
 		}
 
 		for _, group := range groups {
-			if !groupIncludeExcludePass(include, exclude, group) {
+			if !filter.groupPass(group.FullPath) {
 				continue
 			}
 
@@ -174,97 +429,12 @@ func (a *App) iterateGroups(
 	return nil
 }
 
-func groupIncludeExcludePass(includeGroups, excludeGroups []string, group *gitlab.Group) (pass bool) {
-	formattedGroupName := "/" + strings.ReplaceAll(group.FullPath, " / ", "/") + "/"
-	include, exclude := true, false
-
-	if len(includeGroups) != 0 {
-		include = false
-		for _, includeGroup := range includeGroups {
-			if strings.Contains(formattedGroupName, "/"+includeGroup+"/") {
-				include = true
-				break
-			}
-		}
-	}
-	if len(excludeGroups) != 0 {
-		for _, excludeGroup := range excludeGroups {
-			if strings.Contains(formattedGroupName, "/"+excludeGroup+"/") {
-				exclude = true
-				break
-			}
-		}
-	}
-
-	return include && (!exclude)
-}
-
-func (a *App) projectIncludeExcludePass(
-	includeProjects, excludeProjects,
-	includeLanguages, excludeLanguages []string,
-	project *gitlab.Project,
-) (pass bool, err error) {
-	// projects
-	{
-		if len(includeProjects) != 0 { // include
-			include := false
-			for _, includeProject := range includeProjects {
-				if project.Path == includeProject {
-					include = true
-					break
-				}
-			}
-			if !include {
-				return false, nil
-			}
-		}
-
-		if len(excludeProjects) != 0 { // exclude
-			for _, excludeProject := range excludeProjects {
-				if project.Path == excludeProject {
-					return false, nil
-				}
-			}
-		}
-	}
-
-	// languages
-	if len(includeLanguages) != 0 || len(excludeLanguages) != 0 {
-		languages, _, err := a.gitlabClient.Projects.GetProjectLanguages(project.ID)
-		if err != nil {
-			return false, errors.Wrapf(err, "failed to GetProjectLanguages for project.ID %d", project.ID)
-		}
-
-		if len(includeLanguages) != 0 { // include
-			include := false
-			for _, includeLanguage := range includeLanguages {
-				if _, ok := (*languages)[includeLanguage]; ok {
-					include = true
-					break
-				}
-			}
-			if !include {
-				return false, nil
-			}
-		}
-
-		if len(excludeLanguages) != 0 { // exclude
-			for _, excludeLanguage := range excludeLanguages {
-				if _, ok := (*languages)[excludeLanguage]; ok {
-					return false, nil
-				}
-			}
-		}
-	}
-
-	return true, nil
-}
-
 func (a *App) iterateGroupProjects(
 	group *gitlab.Group,
 	projectCallback func(project *gitlab.Project) (err error),
-	includeProjects, excludeProjects,
-	includeLanguages, excludeLanguages []string,
+	sources Sources,
+	filter Filter,
+	listOptions ...gitlab.RequestOptionFunc,
 ) (err error) {
 	for page, perPage := 1, 100; ; page++ {
 		groupProjects, _, err := a.gitlabClient.Groups.ListGroupProjects(group.ID, &gitlab.ListGroupProjectsOptions{
@@ -272,21 +442,18 @@ func (a *App) iterateGroupProjects(
 				Page:    page,
 				PerPage: perPage,
 			},
-			Archived:         pointerToVar(false),
+			Archived:         sources.archivedOption(),
 			IncludeSubGroups: pointerToVar(false),
-		})
+			WithShared:       sources.Shared,
+		}, listOptions...)
 		if err != nil {
 			return errors.Wrap(err, "failed to client.Groups.ListGroupProjects")
 		}
 
 		for _, groupProject := range groupProjects {
-			pass, err := a.projectIncludeExcludePass(
-				includeProjects, excludeProjects,
-				includeLanguages, excludeLanguages,
-				groupProject,
-			)
+			pass, err := a.projectPass(filter, groupProject)
 			if err != nil {
-				return errors.Wrap(err, "failed to projectIncludeExcludePass")
+				return errors.Wrap(err, "failed to projectPass")
 			}
 
 			if !pass {
@@ -306,58 +473,311 @@ func (a *App) iterateGroupProjects(
 	return nil
 }
 
+// iterateUserProjects iterates over projects of the current user namespace (owned)
+// and/or projects starred by the current user
+func (a *App) iterateUserProjects(
+	projectCallback func(project *gitlab.Project) (err error),
+	sources Sources,
+	filter Filter,
+	listOptions ...gitlab.RequestOptionFunc,
+) (err error) {
+	user, _, err := a.gitlabClient.Users.CurrentUser()
+	if err != nil {
+		return errors.Wrap(err, "failed to client.Users.CurrentUser")
+	}
+
+	type listFunc func(uid interface{}, opt *gitlab.ListProjectsOptions, options ...gitlab.RequestOptionFunc) ([]*gitlab.Project, *gitlab.Response, error)
+	listFuncs := []listFunc{}
+	if sources.Owned {
+		listFuncs = append(listFuncs, a.gitlabClient.Projects.ListUserProjects)
+	}
+	if sources.Starred {
+		listFuncs = append(listFuncs, a.gitlabClient.Projects.ListUserStarredProjects)
+	}
+
+	for _, list := range listFuncs {
+		for page, perPage := 1, 100; ; page++ {
+			projects, _, err := list(user.ID, &gitlab.ListProjectsOptions{
+				ListOptions: gitlab.ListOptions{
+					Page:    page,
+					PerPage: perPage,
+				},
+				Archived: sources.archivedOption(),
+			}, listOptions...)
+			if err != nil {
+				return errors.Wrap(err, "failed to list user projects")
+			}
+
+			for _, project := range projects {
+				if project.Namespace != nil && !filter.groupPass(project.Namespace.FullPath) {
+					continue
+				}
+				pass, err := a.projectPass(filter, project)
+				if err != nil {
+					return errors.Wrap(err, "failed to projectPass")
+				}
+
+				if !pass {
+					continue
+				}
+				err = projectCallback(project)
+				if err != nil {
+					return errors.Wrap(err, "failed to projectCallback")
+				}
+			}
+
+			if len(projects) != perPage {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// UpstreamRemoteName - name of the remote pointing to the project the fork was forked from
+const UpstreamRemoteName = "upstream"
+
+// addUpstreamRemote adds UpstreamRemoteName remote to the forked submodule repo (if missing)
+func (a *App) addUpstreamRemote(submodule *git.Submodule, forkedFrom *gitlab.ForkParent) (err error) {
+	upstreamURL := forkedFrom.HTTPURLToRepo
+	// ForkParent contains only http url, prefer ssh url like origin does
+	upstreamProject, _, err := a.gitlabClient.Projects.GetProject(forkedFrom.ID, &gitlab.GetProjectOptions{})
+	if err != nil {
+		a.log.With("forkedFrom", forkedFrom.PathWithNamespace, zap.Error(err)).
+			Warn("failed to get upstream project, using http url")
+	} else if upstreamProject.SSHURLToRepo != "" {
+		upstreamURL = upstreamProject.SSHURLToRepo
+	}
+
+	// not submodule.Repository() because it randomly throws error
+	submoduleRepo, err := git.PlainOpen(a.getSubmodulePath(submodule))
+	if err != nil {
+		return errors.Wrap(err, "failed to git.PlainOpen")
+	}
+
+	_, err = submoduleRepo.CreateRemote(&config.RemoteConfig{
+		Name: UpstreamRemoteName,
+		URLs: []string{upstreamURL},
+	})
+	if err != nil && !errors.Is(err, git.ErrRemoteExists) {
+		return errors.Wrap(err, "failed to submoduleRepo.CreateRemote")
+	}
+
+	return nil
+}
+
+// addProjectSubmodule adds submodule of the project (see addSubmoduleToRepo) and configures it:
+// syncs lfs objects (lfs - lfs is enabled in the project), writes tracking branch (if branch is set) to .gitmodules.
+// err - the submodule isn't added, stepErr - the submodule is added but the first configuring step failed.
+func (a *App) addProjectSubmodule(
+	mainProjectRepo *git.Repository,
+	gitmodulesMu *sync.Mutex, // git config can't be written concurrently
+	submodulePath, submoduleURL, branch string,
+	lfs bool,
+	cloneOpts CloneOptions,
+	log *zap.SugaredLogger,
+) (submodule *git.Submodule, added bool, stepErr, err error) {
+	cloneOpts.sparsePatterns, _ = cloneOpts.Sparse.patterns(submodulePath)
+
+	submodule, added, err = addSubmoduleToRepo(mainProjectRepo, gitmodulesMu, submodulePath, submoduleURL, cloneOpts, log)
+	if err != nil {
+		return nil, false, nil, errors.Wrap(err, "failed to addSubmoduleToRepo")
+	}
+
+	_, err = syncLFS(a.getSubmodulePath(submodule), cloneOpts.LFS, lfs, log)
+	if err != nil {
+		log.With(zap.Error(err)).Error("failed to syncLFS")
+		stepErr = errors.Wrap(err, "failed to syncLFS")
+	}
+
+	if branch != "" {
+		gitmodulesMu.Lock()
+		changed, err := a.setSubmoduleTrackingBranch(submodule.Config().Name, branch)
+		gitmodulesMu.Unlock()
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to setSubmoduleTrackingBranch")
+			if stepErr == nil {
+				stepErr = errors.Wrap(err, "failed to setSubmoduleTrackingBranch")
+			}
+		} else if changed {
+			log.With("branch", branch).Info("submodule tracking branch updated")
+		}
+	}
+
+	return submodule, added, stepErr, nil
+}
+
+// CloneOptions - options for the clone performed by addSubmoduleToRepo
+type CloneOptions struct {
+	Depth        int    // 0 - full history
+	Filter       string // partial clone filter e.g. "blob:none", "" - full clone
+	SingleBranch bool   // clone only the default branch
+
+	Sparse         SparseProfiles // sparse-checkout profiles, applied on the first clone
+	sparsePatterns []string       // cone patterns of the profile matching the cloned project
+
+	RecursiveDepth int // max depth of nested submodules to init and update, 0 - don't touch nested submodules
+
+	LFS LFSOptions // handled by fill after addSubmoduleToRepo (only for projects with lfs enabled)
+}
+
+// cloneRepo clones repo into repoPath using CloneOptions (except recursive options),
+// with lfs fetch / pull lfs objects are not downloaded by clone (see LFSOptions.cloneEnv, syncLFS)
+func cloneRepo(dir, repoURL, repoPath string, cloneOpts CloneOptions) (err error) {
+	args := []string{"clone"}
+	if cloneOpts.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(cloneOpts.Depth))
+	}
+	if cloneOpts.Filter != "" {
+		args = append(args, "--filter", cloneOpts.Filter)
+	}
+	if cloneOpts.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if len(cloneOpts.sparsePatterns) != 0 {
+		args = append(args, "--sparse") // checkout only top level files until sparse-checkout set
+	}
+	args = append(args, "--", repoURL, repoPath)
+
+	_, err = runGitEnv(dir, cloneOpts.LFS.cloneEnv(), args...)
+	if err != nil {
+		return errors.Wrap(err, "failed to clone")
+	}
+
+	return nil
+}
+
+// isExistingClone returns true if repoPath contains standalone clone of submoduleURL
+// (e.g. cloned manually before fill), error if it is a clone of another repo
+func isExistingClone(repoPath, submoduleURL string) (exists bool, err error) {
+	_, err = os.Stat(path.Join(repoPath, ".git"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "failed to os.Stat")
+	}
+
+	originURL, err := runGit(repoPath, "remote", "get-url", "origin")
+	if err != nil {
+		return false, errors.Wrap(err, "existing repo without origin remote")
+	}
+	if originURL == submoduleURL {
+		return true, nil
+	}
+
+	// the same project with other protocol e.g. https instead of ssh
+	originProjectPath, originErr := projectPathFromURL(originURL)
+	projectPath, err := projectPathFromURL(submoduleURL)
+	if originErr != nil || err != nil || originProjectPath != projectPath {
+		return false, errors.Errorf("existing repo is a clone of %q, not of %q", originURL, submoduleURL)
+	}
+
+	return true, nil
+}
+
+// registerSubmodule adds repo already cloned into submodulePath as submodule:
+// git submodule add adopts it (writes .gitmodules and the index), absorbgitdirs moves it's .git to .git/modules
+func registerSubmodule(mainProjectPath, submodulePath, submoduleURL string, lfs LFSOptions) (err error) {
+	_, err = runGitEnv(mainProjectPath, lfs.cloneEnv(), "submodule", "add", "--", submoduleURL, submodulePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to submodule add")
+	}
+	_, err = runGit(mainProjectPath, "submodule", "absorbgitdirs", "--", submodulePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to submodule absorbgitdirs")
+	}
+
+	return nil
+}
+
+// addSubmoduleToRepo adds submodule if it is missing (added == true) and inits it.
+// Existing standalone clone of submoduleURL at submodulePath is adopted without clone.
+// The repo is cloned without gitmodulesMu (clones run in parallel), .gitmodules, .git/config
+// and the index of the main project are changed under gitmodulesMu.
 func addSubmoduleToRepo(
 	repo *git.Repository,
+	gitmodulesMu *sync.Mutex, // git config can't be written concurrently
 	submodulePath,
 	submoduleURL string,
+	cloneOpts CloneOptions,
 	log *zap.SugaredLogger,
-) (submodule *git.Submodule, err error) {
+) (submodule *git.Submodule, added bool, err error) {
 	wt, err := repo.Worktree()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to repo.Worktree")
+		return nil, false, errors.Wrap(err, "failed to repo.Worktree")
 	}
 	log = log.With(
 		"submodulePath", submodulePath,
 		"submoduleURL", submoduleURL,
 	)
 
-	submodule, err = wt.Submodule(submodulePath)
+	gitmodulesMu.Lock()
+	_, err = wt.Submodule(submodulePath)
+	gitmodulesMu.Unlock()
 	if err != nil && errors.Is(err, git.ErrSubmoduleNotFound) {
 		log.Info("submodule not exists, creating ...")
 
-		args := []string{"submodule", "add", submoduleURL}
-		if submodulePath != "" {
-			args = append(args, submodulePath)
-		}
-		cmd := exec.Command("git", args...)
-		cmd.Env = os.Environ()
-		cmd.Env = append(cmd.Env, "LC_ALL", "C")
-		cmd.Dir = wt.Filesystem.Root()
-		// var out bytes.Buffer
-		var stderr bytes.Buffer
-		// cmd.Stdout = &out
-		cmd.Stderr = &stderr
-		err = cmd.Run()
+		adopted, err := isExistingClone(path.Join(wt.Filesystem.Root(), submodulePath), submoduleURL)
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to exec.Command(git submodule add) "+stderr.String())
+			return nil, false, errors.Wrap(err, "failed to isExistingClone")
 		}
 
-		log.Info("submodule created")
+		if adopted {
+			// git submodule add adopts existing repo as is (branches, worktree), without clone
+			log.Info("adopting existing clone ...")
+		} else {
+			err = cloneRepo(wt.Filesystem.Root(), submoduleURL, submodulePath, cloneOpts)
+			if err != nil {
+				return nil, false, errors.Wrap(err, "failed to cloneRepo")
+			}
+		}
 
-		submodule, err = wt.Submodule(submodulePath)
+		gitmodulesMu.Lock()
+		err = registerSubmodule(wt.Filesystem.Root(), submodulePath, submoduleURL, cloneOpts.LFS)
+		gitmodulesMu.Unlock()
 		if err != nil {
-			return nil, errors.Wrap(err, "failed to wt.Submodule after submodule add")
+			return nil, false, errors.Wrap(err, "failed to registerSubmodule")
 		}
+
+		if len(cloneOpts.sparsePatterns) != 0 && !adopted { // don't change worktree of adopted clones
+			_, err = applySparseProfile(path.Join(wt.Filesystem.Root(), submodulePath), cloneOpts.sparsePatterns, true, log)
+			if err != nil {
+				return nil, false, errors.Wrap(err, "failed to applySparseProfile")
+			}
+		}
+
+		log.Info("submodule created")
+		added = true
 	} else if err != nil {
-		return nil, errors.Wrap(err, "failed to wt.Submodule")
+		return nil, false, errors.Wrap(err, "failed to wt.Submodule")
 	} else {
 		log.Debug("submodule exists")
 	}
 
-	err = submodule.Init()
-	if err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
-		return nil, errors.Wrap(err, "failed to submodule.Init")
+	gitmodulesMu.Lock()
+	submodule, err = wt.Submodule(submodulePath)
+	if err == nil {
+		err = submodule.Init()
+		if errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			err = nil
+		}
+	}
+	gitmodulesMu.Unlock()
+	if err != nil {
+		return nil, false, errors.Wrap(err, "failed to init submodule")
+	}
+
+	if cloneOpts.RecursiveDepth > 0 {
+		err = updateNestedSubmodules(
+			path.Join(wt.Filesystem.Root(), submodulePath),
+			[]string{submoduleURL}, cloneOpts.RecursiveDepth, nil, log,
+		)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "failed to updateNestedSubmodules")
+		}
 	}
 
-	return submodule, nil
+	return submodule, added, nil
 }
@@ -0,0 +1,242 @@
+package app
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/xanzy/go-gitlab"
+)
+
+// Filter - include / exclude rules for groups, projects and languages.
+// The same rules are used by fill (for gitlab projects) and by pull (for submodules).
+type Filter struct {
+	IncludeGroups, ExcludeGroups       []string
+	IncludeProjects, ExcludeProjects   []string
+	IncludeLanguages, ExcludeLanguages []string
+}
+
+// groupPass checks full group path e.g. "platform/billing".
+// Include / exclude group matches the group itself and all it's subgroups
+// e.g. "platform" and "platform/billing" both match "platform/billing".
+func (f Filter) groupPass(groupFullPath string) (pass bool) {
+	formattedGroupName := "/" + strings.ReplaceAll(groupFullPath, " / ", "/") + "/"
+	include, exclude := true, false
+
+	if len(f.IncludeGroups) != 0 {
+		include = false
+		for _, includeGroup := range f.IncludeGroups {
+			if strings.Contains(formattedGroupName, "/"+includeGroup+"/") {
+				include = true
+				break
+			}
+		}
+	}
+	if len(f.ExcludeGroups) != 0 {
+		for _, excludeGroup := range f.ExcludeGroups {
+			if strings.Contains(formattedGroupName, "/"+excludeGroup+"/") {
+				exclude = true
+				break
+			}
+		}
+	}
+
+	return include && (!exclude)
+}
+
+// projectPass checks project path (last element of full path) e.g. "api" for "platform/billing/api"
+func (f Filter) projectPass(projectPath string) (pass bool) {
+	if len(f.IncludeProjects) != 0 { // include
+		include := false
+		for _, includeProject := range f.IncludeProjects {
+			if projectPath == includeProject {
+				include = true
+				break
+			}
+		}
+		if !include {
+			return false
+		}
+	}
+
+	if len(f.ExcludeProjects) != 0 { // exclude
+		for _, excludeProject := range f.ExcludeProjects {
+			if projectPath == excludeProject {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// fullPathPass checks full project path e.g. "platform/billing/api" by group and project rules
+func (f Filter) fullPathPass(projectFullPath string) (pass bool) {
+	projectFullPath = strings.ReplaceAll(projectFullPath, " / ", "/")
+	groupFullPath, projectPath := path.Split(projectFullPath)
+
+	return f.groupPass(strings.TrimSuffix(groupFullPath, "/")) && f.projectPass(projectPath)
+}
+
+// withLanguages returns true if languages rules are set (it requires gitlab api request per project)
+func (f Filter) withLanguages() bool {
+	return len(f.IncludeLanguages) != 0 || len(f.ExcludeLanguages) != 0
+}
+
+// languagesPass checks project languages
+func (f Filter) languagesPass(languages gitlab.ProjectLanguages) (pass bool) {
+	if len(f.IncludeLanguages) != 0 { // include
+		include := false
+		for _, includeLanguage := range f.IncludeLanguages {
+			if _, ok := languages[includeLanguage]; ok {
+				include = true
+				break
+			}
+		}
+		if !include {
+			return false
+		}
+	}
+
+	if len(f.ExcludeLanguages) != 0 { // exclude
+		for _, excludeLanguage := range f.ExcludeLanguages {
+			if _, ok := languages[excludeLanguage]; ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// projectPass checks gitlab project by projects and languages rules
+func (a *App) projectPass(filter Filter, project *gitlab.Project) (pass bool, err error) {
+	if !filter.projectPass(project.Path) {
+		return false, nil
+	}
+
+	if filter.withLanguages() {
+		pass, err = a.projectLanguagesPass(filter, project.ID)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to projectLanguagesPass")
+		}
+		if !pass {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// projectLanguagesPass checks languages of gitlab project.
+// pid - project ID or full path of the project.
+func (a *App) projectLanguagesPass(filter Filter, pid interface{}) (pass bool, err error) {
+	languages, resp, err := a.gitlabClient.Projects.GetProjectLanguages(pid)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		// not a gitlab project (e.g. added from manifest), languages are unknown
+		return filter.languagesPass(gitlab.ProjectLanguages{}), nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to GetProjectLanguages for project %v", pid)
+	}
+
+	return filter.languagesPass(*languages), nil
+}
+
+// submodulePass checks submodule by the same rules as gitlab projects are checked by fill
+func (a *App) submodulePass(filter Filter, submodule *git.Submodule) (pass bool, err error) {
+	if !filter.fullPathPass(submodule.Config().Path) {
+		return false, nil
+	}
+
+	if filter.withLanguages() {
+		projectPath, err := a.gitlabProjectPath(submodule.Config().URL)
+		if errors.Is(err, errNotGitlabURL) { // e.g. added from manifest, languages are unknown
+			return filter.languagesPass(gitlab.ProjectLanguages{}), nil
+		}
+		if err != nil {
+			return false, errors.Wrap(err, "failed to gitlabProjectPath")
+		}
+		pass, err = a.projectLanguagesPass(filter, projectPath)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to projectLanguagesPass")
+		}
+		if !pass {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// errNotGitlabURL - remote url is not on the gitlab host, so the project can't be found in gitlab by it's path
+var errNotGitlabURL = errors.New("remote url is not on the gitlab host")
+
+// gitlabProjectPath returns full path of the gitlab project by it's remote url (see projectPathFromURL),
+// errNotGitlabURL if the url host differs from the gitlab api host (e.g. github repo added from manifest),
+// otherwise an unrelated gitlab project with the same path could be found
+func (a *App) gitlabProjectPath(remoteURL string) (projectPath string, err error) {
+	projectPath, err = projectPathFromURL(remoteURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to projectPathFromURL")
+	}
+	if !isSameHost(remoteURLHost(remoteURL), a.gitlabClient.BaseURL().Hostname()) {
+		return "", errors.Wrapf(errNotGitlabURL, "%s", remoteURL)
+	}
+
+	return projectPath, nil
+}
+
+// remoteURLHost returns lowercase host of the remote url e.g. "git@gitlab.ru:group/api.git" -> "gitlab.ru",
+// "" for local paths
+func remoteURLHost(remoteURL string) (host string) {
+	if !strings.Contains(remoteURL, "://") { // scp-like syntax
+		host, _, found := strings.Cut(remoteURL, ":")
+		if !found {
+			return ""
+		}
+		if _, h, found := strings.Cut(host, "@"); found {
+			host = h
+		}
+		return strings.ToLower(host)
+	}
+
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// isSameHost returns true if hosts are equal or one is subdomain of the other
+// e.g. ssh host "ssh.gitlab.ru" of api host "gitlab.ru"
+func isSameHost(host, otherHost string) bool {
+	host, otherHost = strings.ToLower(host), strings.ToLower(otherHost)
+	if host == "" || otherHost == "" {
+		return false
+	}
+	return host == otherHost || strings.HasSuffix(host, "."+otherHost) || strings.HasSuffix(otherHost, "."+host)
+}
+
+// projectPathFromURL returns full path of the project from it's remote url e.g.
+// "git@gitlab.ru:platform/billing/api.git", "ssh://git@gitlab.ru:2222/platform/billing/api.git",
+// "https://gitlab.ru/platform/billing/api.git" -> "platform/billing/api"
+func projectPathFromURL(remoteURL string) (projectPath string, err error) {
+	if !strings.Contains(remoteURL, "://") { // scp-like syntax
+		_, projectPath, found := strings.Cut(remoteURL, ":")
+		if !found {
+			return "", errors.Errorf("unexpected remote url %q", remoteURL)
+		}
+		return strings.TrimSuffix(strings.Trim(projectPath, "/"), ".git"), nil
+	}
+
+	u, err := url.Parse(remoteURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to url.Parse")
+	}
+
+	return strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), nil
+}
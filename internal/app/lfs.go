@@ -0,0 +1,77 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LFSMode - how to handle git lfs objects after clone / pull
+type LFSMode string
+
+const (
+	LFSSkip  LFSMode = "skip"  // don't touch lfs objects (files stay as pointers if git-lfs filter isn't installed)
+	LFSFetch LFSMode = "fetch" // download lfs objects to .git/lfs without checkout
+	LFSPull  LFSMode = "pull"  // download lfs objects and replace pointer files in worktree
+)
+
+// lfsSkipSmudgeEnv disables download of lfs objects by git-lfs filter during clone / checkout,
+// they are downloaded by syncLFS according to LFSOptions (see LFSOptions.cloneEnv)
+const lfsSkipSmudgeEnv = "GIT_LFS_SKIP_SMUDGE=1"
+
+// LFSOptions - options of git lfs handling for fill and pull
+type LFSOptions struct {
+	Mode LFSMode
+
+	// path patterns (git lfs --include / --exclude) e.g. "assets/**,*.psd"
+	Include, Exclude []string
+}
+
+func (o LFSOptions) enabled() bool {
+	return o.Mode == LFSFetch || o.Mode == LFSPull
+}
+
+// cloneEnv returns environment for clone: with fetch / pull lfs objects are downloaded by syncLFS afterwards
+// (only included ones), with skip git-lfs filter (if installed) downloads them as usual
+func (o LFSOptions) cloneEnv() (env []string) {
+	if o.enabled() {
+		return []string{lfsSkipSmudgeEnv}
+	}
+	return nil
+}
+
+// usesLFS returns true if any .gitattributes of the repo HEAD contains "filter=lfs"
+func usesLFS(repoPath string) (uses bool) {
+	// exit code 1 if nothing is found (or there is no HEAD yet)
+	out, _ := runGit(repoPath, "grep", "-l", "filter=lfs", "HEAD", "--", ".gitattributes", ":(glob)**/.gitattributes")
+	return out != ""
+}
+
+// syncLFS fetches (or pulls) lfs objects of the repo if it uses lfs (synced == true):
+// lfsEnabled (e.g. lfs is enabled in the gitlab project) or .gitattributes of the repo say so
+func syncLFS(repoPath string, opts LFSOptions, lfsEnabled bool, log *zap.SugaredLogger) (synced bool, err error) {
+	if !opts.enabled() {
+		return false, nil
+	}
+
+	if !lfsEnabled && !usesLFS(repoPath) {
+		return false, nil
+	}
+
+	args := []string{"lfs", string(opts.Mode)}
+	if len(opts.Include) != 0 {
+		args = append(args, "--include="+strings.Join(opts.Include, ","))
+	}
+	if len(opts.Exclude) != 0 {
+		args = append(args, "--exclude="+strings.Join(opts.Exclude, ","))
+	}
+
+	_, err = runGit(repoPath, args...)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to git lfs %s (is git-lfs installed?)", opts.Mode)
+	}
+	log.With("lfs", opts.Mode).Info("lfs objects synced")
+
+	return true, nil
+}
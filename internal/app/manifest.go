@@ -0,0 +1,436 @@
+package app
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pkg/errors"
+	"github.com/xanzy/go-gitlab"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest - declarative list of the main project repos (see ExportManifest, FillMainProjectFromManifest)
+type Manifest struct {
+	Projects []ManifestProject `yaml:"projects" toml:"projects"`
+}
+
+// ManifestProject - repo of the Manifest
+type ManifestProject struct {
+	Path      string   `yaml:"path" toml:"path"`                               // path in the main project
+	URL       string   `yaml:"url" toml:"url"`                                 // clone url, not only gitlab e.g. "https://github.com/org/repo.git"
+	Branch    string   `yaml:"branch,omitempty" toml:"branch,omitempty"`       // default (tracking) branch
+	Groups    []string `yaml:"groups,omitempty" toml:"groups,omitempty"`       // full paths of gitlab groups e.g. "platform/billing"
+	Languages []string `yaml:"languages,omitempty" toml:"languages,omitempty"` // gitlab project languages
+}
+
+// pass checks manifest project by filter (without gitlab api):
+// groups rules by Groups (or by Path if Groups are empty), projects rules by Path, languages rules by Languages
+func (p ManifestProject) pass(filter Filter) bool {
+	groups := p.Groups
+	if len(groups) == 0 {
+		groups = []string{path.Dir(p.Path)}
+	}
+	groupPass := false
+	for _, group := range groups {
+		if filter.groupPass(group) {
+			groupPass = true
+			break
+		}
+	}
+	if !groupPass || !filter.projectPass(path.Base(p.Path)) {
+		return false
+	}
+
+	if filter.withLanguages() {
+		languages := make(gitlab.ProjectLanguages, len(p.Languages))
+		for _, language := range p.Languages {
+			languages[language] = 0
+		}
+		return filter.languagesPass(languages)
+	}
+
+	return true
+}
+
+// xmlManifest - repo tool like xml representation of the Manifest
+type xmlManifest struct {
+	XMLName  xml.Name             `xml:"manifest"`
+	Projects []xmlManifestProject `xml:"project"`
+}
+
+type xmlManifestProject struct {
+	Path      string `xml:"path,attr"`
+	URL       string `xml:"url,attr"`
+	Branch    string `xml:"branch,attr,omitempty"`
+	Groups    string `xml:"groups,attr,omitempty"`    // comma separated
+	Languages string `xml:"languages,attr,omitempty"` // comma separated
+}
+
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// manifest file formats (by extension)
+const (
+	manifestYAML = "yaml"
+	manifestTOML = "toml"
+	manifestXML  = "xml"
+)
+
+// manifestFormat returns format of the manifest file by it's extension, yaml by default
+func manifestFormat(manifestPath string) (format string) {
+	switch strings.ToLower(filepath.Ext(manifestPath)) {
+	case ".xml":
+		return manifestXML
+	case ".toml":
+		return manifestTOML
+	default:
+		return manifestYAML
+	}
+}
+
+// readManifest reads Manifest from the yaml, toml or xml (by extension) file
+func readManifest(manifestPath string) (manifest Manifest, err error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return Manifest{}, errors.Wrap(err, "failed to os.ReadFile")
+	}
+
+	switch manifestFormat(manifestPath) {
+	case manifestTOML:
+		err = toml.Unmarshal(data, &manifest)
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "failed to toml.Unmarshal")
+		}
+	case manifestXML:
+		xm := xmlManifest{}
+		err = xml.Unmarshal(data, &xm)
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "failed to xml.Unmarshal")
+		}
+		for _, p := range xm.Projects {
+			manifest.Projects = append(manifest.Projects, ManifestProject{
+				Path:      p.Path,
+				URL:       p.URL,
+				Branch:    p.Branch,
+				Groups:    splitList(p.Groups),
+				Languages: splitList(p.Languages),
+			})
+		}
+	default:
+		err = yaml.Unmarshal(data, &manifest)
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "failed to yaml.Unmarshal")
+		}
+	}
+
+	return manifest, nil
+}
+
+// writeManifest writes Manifest to the yaml, toml or xml (by extension) file
+func writeManifest(manifestPath string, manifest Manifest) (err error) {
+	var data []byte
+	switch manifestFormat(manifestPath) {
+	case manifestTOML:
+		data, err = toml.Marshal(manifest)
+		if err != nil {
+			return errors.Wrap(err, "failed to toml.Marshal")
+		}
+	case manifestXML:
+		xm := xmlManifest{}
+		for _, p := range manifest.Projects {
+			xm.Projects = append(xm.Projects, xmlManifestProject{
+				Path:      p.Path,
+				URL:       p.URL,
+				Branch:    p.Branch,
+				Groups:    strings.Join(p.Groups, ","),
+				Languages: strings.Join(p.Languages, ","),
+			})
+		}
+		data, err = xml.MarshalIndent(xm, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to xml.MarshalIndent")
+		}
+		data = append([]byte(xml.Header), append(data, '\n')...)
+	default:
+		buf := &bytes.Buffer{}
+		encoder := yaml.NewEncoder(buf)
+		encoder.SetIndent(2)
+		err = encoder.Encode(manifest)
+		if err != nil {
+			return errors.Wrap(err, "failed to yaml.Encode")
+		}
+		data = buf.Bytes()
+	}
+
+	err = os.WriteFile(manifestPath, data, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to os.WriteFile")
+	}
+
+	return nil
+}
+
+// ExportManifest writes Manifest (yaml, toml or xml by extension) of the selected projects:
+// from the main project submodules or (fromGitlab) from gitlab projects selected the same way as by fill.
+// Without gitlab client (main project only) groups are taken from paths and languages are not exported.
+func (a *App) ExportManifest(filter Filter, sources Sources, kinds Kinds, fromGitlab bool, manifestPath string) (err error) {
+	a.log.With(
+		"filter", filter,
+		"sources", sources,
+		"kinds", kinds,
+		"fromGitlab", fromGitlab,
+		"manifest", manifestPath,
+	).Info("ExportManifest")
+
+	var manifest Manifest
+	if fromGitlab {
+		manifest, err = a.gitlabManifest(filter, sources, kinds)
+		if err != nil {
+			return errors.Wrap(err, "failed to gitlabManifest")
+		}
+	} else {
+		manifest, err = a.mainProjectManifest(filter)
+		if err != nil {
+			return errors.Wrap(err, "failed to mainProjectManifest")
+		}
+	}
+	sort.Slice(manifest.Projects, func(i, j int) bool { return manifest.Projects[i].Path < manifest.Projects[j].Path })
+
+	err = writeManifest(manifestPath, manifest)
+	if err != nil {
+		return errors.Wrap(err, "failed to writeManifest")
+	}
+	a.log.With("projects", len(manifest.Projects)).Info("ExportManifest done")
+
+	return nil
+}
+
+// gitlabManifest returns Manifest of gitlab projects selected the same way as by FillMainProject
+func (a *App) gitlabManifest(filter Filter, sources Sources, kinds Kinds) (manifest Manifest, err error) {
+	foundProjects := map[int]struct{}{}
+	addProject := func(project *gitlab.Project) (err error) {
+		if _, ok := foundProjects[project.ID]; ok {
+			return nil
+		}
+		foundProjects[project.ID] = struct{}{}
+
+		if !kinds.pass(project) {
+			return nil
+		}
+
+		manifestProject := ManifestProject{
+			Path:   sources.projectPath(project),
+			URL:    project.SSHURLToRepo,
+			Branch: project.DefaultBranch,
+		}
+		if project.Namespace != nil {
+			manifestProject.Groups = []string{project.Namespace.FullPath}
+		}
+		manifestProject.Languages, err = a.getProjectLanguages(project.ID)
+		if err != nil {
+			return errors.Wrap(err, "failed to getProjectLanguages")
+		}
+		manifest.Projects = append(manifest.Projects, manifestProject)
+
+		return nil
+	}
+
+	err = a.iterateGroups(func(group *gitlab.Group) (err error) {
+		return a.iterateGroupProjects(group, addProject, sources, filter)
+	}, filter)
+	if err != nil {
+		return Manifest{}, errors.Wrap(err, "failed to iterateGroups")
+	}
+
+	if sources.Owned || sources.Starred {
+		err = a.iterateUserProjects(addProject, sources, filter)
+		if err != nil {
+			return Manifest{}, errors.Wrap(err, "failed to iterateUserProjects")
+		}
+	}
+
+	return manifest, nil
+}
+
+// mainProjectManifest returns Manifest of the main project submodules
+func (a *App) mainProjectManifest(filter Filter) (manifest Manifest, err error) {
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return Manifest{}, errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	for _, submodule := range submodules {
+		log := a.log.With("submodule", submodule.Config().Path)
+
+		manifestProject := ManifestProject{
+			Path:   submodule.Config().Path,
+			URL:    submodule.Config().URL,
+			Branch: submodule.Config().Branch,
+			Groups: []string{path.Dir(submodule.Config().Path)},
+		}
+		if manifestProject.Branch == "" {
+			manifestProject.Branch, err = a.getSubmoduleDefaultBranch(submodule)
+			if err != nil {
+				log.With(zap.Error(err)).Warn("failed to getSubmoduleDefaultBranch, branch is not exported")
+			}
+		}
+
+		if a.gitlabClient != nil {
+			projectPath, err := a.gitlabProjectPath(manifestProject.URL)
+			if errors.Is(err, errNotGitlabURL) {
+				log.Debug("not a gitlab repo, languages are not exported")
+			} else if err != nil {
+				log.With(zap.Error(err)).Warn("failed to gitlabProjectPath, languages are not exported")
+			} else {
+				manifestProject.Groups = []string{path.Dir(projectPath)}
+				manifestProject.Languages, err = a.getProjectLanguages(projectPath)
+				if err != nil {
+					log.With(zap.Error(err)).Warn("failed to getProjectLanguages, languages are not exported")
+				}
+			}
+		}
+
+		manifest.Projects = append(manifest.Projects, manifestProject)
+	}
+
+	return manifest, nil
+}
+
+// getProjectLanguages returns sorted languages of gitlab project.
+// pid - project ID or full path of the project.
+func (a *App) getProjectLanguages(pid interface{}) (languages []string, err error) {
+	projectLanguages, _, err := a.gitlabClient.Projects.GetProjectLanguages(pid)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to GetProjectLanguages for project %v", pid)
+	}
+	for language := range *projectLanguages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	return languages, nil
+}
+
+// FillMainProjectFromManifest adds projects of the Manifest (yaml, toml or xml by extension) to the main project
+// the same way as FillMainProject, but without gitlab api
+func (a *App) FillMainProjectFromManifest(
+	manifestPath string,
+	filter Filter,
+	cloneOpts CloneOptions,
+	commit bool, // commit .gitmodules and added submodules to the main project at the end
+	reportOpts ReportOptions,
+) (err error) {
+	a.log.With(
+		"manifest", manifestPath,
+		"filter", filter,
+		"cloneOpts", cloneOpts,
+		"commit", commit,
+		"reportOpts", reportOpts,
+	).Info("FillMainProjectFromManifest")
+
+	manifest, err := readManifest(manifestPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to readManifest")
+	}
+
+	mainProjectRepo, err := a.initMainProject()
+	if err != nil {
+		return errors.Wrap(err, "failed to initMainProject")
+	}
+
+	results := newRunReport("fill")
+	err = a.fillManifestProjects(mainProjectRepo, manifest, filter, cloneOpts, results)
+	if err != nil {
+		return errors.Wrap(err, "failed to fillManifestProjects")
+	}
+
+	err = results.finish(os.Stdout, reportOpts)
+	if err != nil {
+		return errors.Wrap(err, "failed to finish run report")
+	}
+
+	if commit {
+		err = a.commitMainProject("fill", results.paths())
+		if err != nil {
+			return errors.Wrap(err, "failed to commitMainProject")
+		}
+	}
+
+	return results.check(reportOpts.FailOn)
+}
+
+// fillManifestProjects adds projects of the manifest which pass the filter to the main project
+func (a *App) fillManifestProjects(
+	mainProjectRepo *git.Repository,
+	manifest Manifest,
+	filter Filter,
+	cloneOpts CloneOptions,
+	results *runReport,
+) (err error) {
+	var gitmodulesMu sync.Mutex // git config can't be written concurrently
+	g := &errgroup.Group{}
+	for _, project := range manifest.Projects {
+		project := project
+		if project.Path == "" || project.URL == "" {
+			a.log.With("project", project).Warn("manifest project without path or url, skipping")
+			name := project.Path
+			if name == "" {
+				name = project.URL
+			}
+			results.add(name, ReportStatusSkipped, "manifest project without path or url", nil, time.Now())
+			continue
+		}
+		if !project.pass(filter) {
+			continue
+		}
+
+		g.Go(func() (err error) {
+			log := a.log.With("project", project.Path)
+			log.Debug("filling project ...")
+			defer log.Debug("filling project done")
+
+			started := time.Now()
+			_, added, stepErr, err := a.addProjectSubmodule(
+				mainProjectRepo, &gitmodulesMu,
+				project.Path, project.URL, project.Branch, false, // lfs usage is known only from .gitattributes
+				cloneOpts, log,
+			)
+			if err != nil {
+				log.With(zap.Error(err)).Error("failed to addProjectSubmodule")
+				results.add(project.Path, ReportStatusFailed, "", errors.Wrap(err, "failed to addProjectSubmodule"), started)
+				return nil
+			}
+			status := ReportStatusExisted
+			if added {
+				status = ReportStatusAdded
+			}
+			results.add(project.Path, status, "", stepErr, started)
+			return nil
+		})
+	}
+
+	err = g.Wait()
+	if err != nil {
+		return errors.Wrap(err, "failed to g.Wait")
+	}
+
+	return nil
+}
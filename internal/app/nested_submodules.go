@@ -0,0 +1,186 @@
+package app
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultRecursiveDepth - default max depth of nested submodules for recursive fill / pull
+const DefaultRecursiveDepth = 5
+
+// updateNestedSubmodules inits and updates (checkouts commits recorded by parent repo)
+// nested submodules of the repo recursively, up to maxDepth levels of nesting.
+// Already cloned nested submodules are not reset to the recorded commits: fill doesn't touch them
+// (pull leaves them on the branch ahead of the recorded commit), pull (pullOpts) pulls them
+// on their tracking / default branch (see pullNestedSubmodule).
+// parentURLs - remote urls of the repo and it's parents, used for cycles detection.
+func updateNestedSubmodules(
+	repoPath string,
+	parentURLs []string,
+	maxDepth int,
+	pullOpts *PullOptions, // nil - only checkout recorded commits (fill)
+	log *zap.SugaredLogger,
+) (err error) {
+	if maxDepth <= 0 {
+		return nil
+	}
+
+	// exit code 1 if there are no keys (or no .gitmodules)
+	paths, _ := runGit(repoPath, "config", "-f", gitmodulesFile, "--get-regexp", `^submodule\..*\.path$`)
+
+	for _, line := range strings.Split(paths, "\n") {
+		key, nestedPath, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "submodule."), ".path")
+		nestedLog := log.With("nestedSubmodule", path.Join(repoPath, nestedPath))
+
+		_, err = runGit(repoPath, "submodule", "init", "--", nestedPath)
+		if err != nil {
+			return errors.Wrapf(err, "failed to submodule init %s", nestedPath)
+		}
+
+		// url after init is resolved (relative urls like ../proto.git become absolute)
+		nestedURL, err := runGit(repoPath, "config", "--get", "submodule."+name+".url")
+		if err != nil {
+			return errors.Wrapf(err, "failed to get url of %s", nestedPath)
+		}
+		if containsRemoteURL(parentURLs, nestedURL) {
+			nestedLog.With("url", nestedURL).Warn("submodules cycle detected, skipping...")
+			continue
+		}
+
+		nestedRepoPath := path.Join(repoPath, nestedPath)
+		_, err = os.Stat(path.Join(nestedRepoPath, ".git"))
+		cloned := err == nil
+		if !cloned {
+			_, err = runGit(repoPath, "submodule", "update", "--", nestedPath)
+			if err != nil {
+				return errors.Wrapf(err, "failed to submodule update %s", nestedPath)
+			}
+			nestedLog.Debug("nested submodule updated")
+		}
+		if pullOpts != nil {
+			err = pullNestedSubmodule(repoPath, name, nestedRepoPath, *pullOpts, nestedLog)
+			if err != nil {
+				return errors.Wrapf(err, "failed to pullNestedSubmodule %s", nestedPath)
+			}
+		}
+
+		nestedParentURLs := append(append([]string{}, parentURLs...), nestedURL)
+		if maxDepth == 1 {
+			if hasSubmodules(nestedRepoPath) {
+				nestedLog.Warn("max depth of nested submodules reached, skipping deeper submodules")
+			}
+			continue
+		}
+		err = updateNestedSubmodules(nestedRepoPath, nestedParentURLs, maxDepth-1, pullOpts, log)
+		if err != nil {
+			return errors.Wrapf(err, "failed to updateNestedSubmodules of %s", nestedPath)
+		}
+	}
+
+	return nil
+}
+
+// pullNestedSubmodule pulls nested submodule on it's tracking branch (from .gitmodules of the parent repo)
+// or default branch. Detached HEAD (after submodule update) is switched to the branch,
+// submodules on other branches are skipped like by pull.
+func pullNestedSubmodule(repoPath, name, nestedRepoPath string, opts PullOptions, log *zap.SugaredLogger) (err error) {
+	if opts.Strategy == PullStrategyFetch { // worktree and branches are not touched
+		_, err = runGit(nestedRepoPath, "fetch", "origin")
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch")
+		}
+		return nil
+	}
+
+	branch, err := runGit(repoPath, "config", "-f", gitmodulesFile, "--get", "submodule."+name+".branch")
+	if err != nil || branch == "." { // no tracking branch
+		branch, err = getNestedDefaultBranch(nestedRepoPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to getNestedDefaultBranch")
+		}
+	}
+	log = log.With("branch", branch)
+
+	currentBranch, err := runGit(nestedRepoPath, "branch", "--show-current")
+	if err != nil {
+		return errors.Wrap(err, "failed to get current branch")
+	}
+	switch currentBranch {
+	case branch:
+	case "": // detached at the recorded commit
+		_, err = runGit(nestedRepoPath, "fetch", "origin")
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch")
+		}
+		_, err = runGit(nestedRepoPath, "switch", branch)
+		if err != nil {
+			return errors.Wrap(err, "failed to switch")
+		}
+	default:
+		log.With("currentBranch", currentBranch).Warn("nested submodule is not on it's tracking branch, skipping...")
+		return nil
+	}
+
+	outcome, err := pullWithGit(nestedRepoPath, branch, opts, log)
+	if err != nil {
+		return errors.Wrap(err, "failed to pullWithGit")
+	}
+	log.With("outcome", outcome).Debug("nested submodule pulled")
+
+	return nil
+}
+
+// getNestedDefaultBranch returns default branch of the nested submodule from origin/HEAD or from the remote
+func getNestedDefaultBranch(repoPath string) (branch string, err error) {
+	originHead, err := runGit(repoPath, "symbolic-ref", "--short", "refs/remotes/origin/HEAD")
+	if err == nil {
+		return strings.TrimPrefix(originHead, "origin/"), nil
+	}
+
+	return getRemoteDefaultBranchName(repoPath)
+}
+
+// hasSubmodules returns true if repo has .gitmodules with at least one submodule
+func hasSubmodules(repoPath string) bool {
+	paths, _ := runGit(repoPath, "config", "-f", gitmodulesFile, "--get-regexp", `^submodule\..*\.path$`)
+	return paths != ""
+}
+
+// containsRemoteURL checks if urls contains remoteURL ignoring protocol and ".git" suffix
+func containsRemoteURL(urls []string, remoteURL string) bool {
+	normalized := normalizeRemoteURL(remoteURL)
+	for _, u := range urls {
+		if normalizeRemoteURL(u) == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeRemoteURL returns "host/path" of remote url, e.g.
+// "git@gitlab.ru:group/project.git", "https://gitlab.ru/group/project" -> "gitlab.ru/group/project"
+func normalizeRemoteURL(remoteURL string) (normalized string) {
+	host, projectPath := "", remoteURL
+	if !strings.Contains(remoteURL, "://") { // scp-like syntax
+		if h, p, found := strings.Cut(remoteURL, ":"); found {
+			host, projectPath = h, p
+			if _, h, found := strings.Cut(host, "@"); found {
+				host = h
+			}
+		}
+	} else if u, err := url.Parse(remoteURL); err == nil {
+		host, projectPath = u.Hostname(), u.Path
+	}
+
+	projectPath = strings.TrimSuffix(strings.Trim(projectPath, "/"), ".git")
+	return strings.ToLower(path.Join(host, projectPath))
+}
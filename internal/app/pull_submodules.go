@@ -1,95 +1,209 @@
 package app
 
 import (
+	"os"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/pkg/errors"
+	"github.com/xanzy/go-gitlab"
 	"go.uber.org/zap"
-	"golang.org/x/exp/slices"
 )
 
-func (a *App) PullMainProjectSubmodules(includeGroups, excludeGroups, includeProjects, excludeProjects []string) (err error) {
+// PullStrategy - how pull updates the current branch of submodule
+type PullStrategy string
+
+const (
+	PullStrategyFFOnly PullStrategy = "ff-only" // fast-forward only
+	PullStrategyRebase PullStrategy = "rebase"  // rebase local commits onto the remote branch
+	PullStrategyFetch  PullStrategy = "fetch"   // only fetch, worktree and branches are not touched
+)
+
+// PullOptions - options for PullMainProjectSubmodules
+type PullOptions struct {
+	FetchUpstream bool // also fetch UpstreamRemoteName remote (forks) if submodule has it
+
+	Strategy  PullStrategy
+	Autostash bool // stash local changes before update and apply them after
+
+	// UpdateBranches - if submodule is not on it's tracking / default branch,
+	// fast-forward local default and tracked branches without checking them out (instead of skipping)
+	UpdateBranches bool
+
+	RecursiveDepth int // max depth of nested submodules to init and update after pull, 0 - don't touch nested submodules
+
+	LFS LFSOptions
+
+	Sparse SparseProfiles // sparse-checkout profiles, reconciled before pull
+
+	Commit bool // commit updated submodules (gitlinks) to the main project at the end
+
+	Report ReportOptions
+}
+
+// PullOutcome - result of pullSubmodule
+type PullOutcome string
+
+const (
+	PullOutcomeUpToDate        PullOutcome = "up-to-date"
+	PullOutcomeUpdated         PullOutcome = "updated"
+	PullOutcomeRebased         PullOutcome = "rebased"
+	PullOutcomeConflictAborted PullOutcome = "conflict-aborted"
+	PullOutcomeFetched         PullOutcome = "fetched"
+	PullOutcomeBranchesUpdated PullOutcome = "branches-updated"
+	PullOutcomeSkippedDirty    PullOutcome = "skipped-dirty"
+	PullOutcomeSkippedBranch   PullOutcome = "skipped-branch"
+	PullOutcomeFailed          PullOutcome = "failed"
+)
+
+func (a *App) PullMainProjectSubmodules(filter Filter, opts PullOptions) (err error) {
 	a.log.With(
-		"includeGroups", includeGroups, "excludeGroups", excludeGroups,
-		"includeProjects", includeProjects, "excludeProjects", excludeProjects,
+		"filter", filter,
+		"opts", opts,
 	).Info("PullMainProjectSubmodules")
 
-	mainProjectRepo, err := a.openMainProject()
+	err = a.syncSubmodulesTrackingBranches()
 	if err != nil {
-		return errors.Wrap(err, "failed to openMainProject")
+		return errors.Wrap(err, "failed to syncSubmodulesTrackingBranches")
 	}
-	wt, err := mainProjectRepo.Worktree()
-	if err != nil {
-		return errors.Wrap(err, "failed to mainProjectRepo.Worktree")
-	}
-	submodules, err := wt.Submodules()
+
+	submodules, err := a.selectSubmodules(filter)
 	if err != nil {
-		return errors.Wrap(err, "failed to wt.Submodules")
+		return errors.Wrap(err, "failed to selectSubmodules")
 	}
 
+	outcomes := map[PullOutcome]int{}
+	results := newRunReport("pull")
 	for _, submodule := range submodules {
-		submoduleFullName := submodule.Config().Name
-		submoduleGroupName := strings.Split(submoduleFullName, "/")[0]
-		submoduleProjectName := strings.Split(submoduleFullName, "/")[1]
+		started := time.Now()
+		var stepErr error // error besides pullSubmodule, the first one goes to the report
 
-		if len(includeGroups) != 0 { // TODO move to func
-			if !slices.Contains(includeGroups, submoduleGroupName) {
-				continue
-			}
-		}
-		if len(excludeGroups) != 0 {
-			if slices.Contains(excludeGroups, submoduleGroupName) {
-				continue
-			}
+		patterns, found := opts.Sparse.patterns(submodule.Config().Path)
+		_, err = applySparseProfile(a.getSubmodulePath(submodule), patterns, found, a.log.With("submodule", submodule.Config().Path))
+		if err != nil {
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to applySparseProfile")
+			stepErr = errors.Wrap(err, "failed to applySparseProfile")
 		}
 
-		if len(includeProjects) != 0 {
-			if !slices.Contains(includeProjects, submoduleProjectName) {
-				continue
-			}
-		}
-		if len(excludeProjects) != 0 {
-			if slices.Contains(excludeProjects, submoduleProjectName) {
-				continue
-			}
+		if isArchivedSubmodule(submodule) { // archived projects can't change
+			results.add(submodule.Config().Path, ReportStatusSkipped, "archived", stepErr, started)
+			continue
 		}
 
-		err = a.pullSubmodule(submodule, a.log)
+		outcome, err := a.pullSubmodule(submodule, opts, a.log)
 		if err != nil {
+			outcomes[PullOutcomeFailed]++
 			a.log.With(
 				"submodule", submodule.Config().Path,
 				"error", err.Error(),
 			).Error("failed to pullSubmodule")
+			results.add(submodule.Config().Path, ReportStatusFailed, "", errors.Wrap(err, "failed to pullSubmodule"), started)
 
 			continue
 		}
+		outcomes[outcome]++
+
+		switch outcome {
+		case PullOutcomeUpToDate, PullOutcomeUpdated, PullOutcomeRebased:
+			_, err = syncLFS(a.getSubmodulePath(submodule), opts.LFS, false, a.log.With("submodule", submodule.Config().Path))
+			if err != nil {
+				a.log.With(
+					"submodule", submodule.Config().Path,
+					"error", err.Error(),
+				).Error("failed to syncLFS")
+				if stepErr == nil {
+					stepErr = errors.Wrap(err, "failed to syncLFS")
+				}
+			}
+
+			if opts.RecursiveDepth == 0 {
+				break
+			}
+			err = updateNestedSubmodules(
+				a.getSubmodulePath(submodule),
+				[]string{submodule.Config().URL}, opts.RecursiveDepth, &opts,
+				a.log.With("submodule", submodule.Config().Path),
+			)
+			if err != nil {
+				a.log.With(
+					"submodule", submodule.Config().Path,
+					"error", err.Error(),
+				).Error("failed to updateNestedSubmodules")
+				if stepErr == nil {
+					stepErr = errors.Wrap(err, "failed to updateNestedSubmodules")
+				}
+			}
+		}
+
+		results.add(submodule.Config().Path, pullOutcomeStatus(outcome), string(outcome), stepErr, started)
 	}
 
-	return nil
+	a.log.With("outcomes", outcomes).Info("PullMainProjectSubmodules done")
+
+	err = results.finish(os.Stdout, opts.Report)
+	if err != nil {
+		return errors.Wrap(err, "failed to finish run report")
+	}
+
+	if opts.Commit {
+		// skipped and failed submodules may be on local feature branches, their HEADs are not committed
+		err = a.commitMainProject("pull", results.paths(ReportStatusUpdated, ReportStatusUpToDate))
+		if err != nil {
+			return errors.Wrap(err, "failed to commitMainProject")
+		}
+	}
+
+	return results.check(opts.Report.FailOn)
 }
 
-func (a *App) pullSubmodule(submodule *git.Submodule, log *zap.SugaredLogger) (err error) {
+func (a *App) pullSubmodule(submodule *git.Submodule, opts PullOptions, log *zap.SugaredLogger) (outcome PullOutcome, err error) {
 	// fmt.Println(submodule.Config().Name)
 	log = log.With("submodule", submodule.Config().Name)
 	log.Debug("pulling submodule...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("pulling submodule done")
+		}
+	}()
 
 	// not submodule.Repository() because it randomly throws error
 	submoduleRepo, err := git.PlainOpen(a.getSubmodulePath(submodule))
 	if err != nil {
-		return errors.Wrap(err, "failed to submodule.Repository")
+		return "", errors.Wrap(err, "failed to submodule.Repository")
+	}
+
+	if opts.FetchUpstream {
+		err = fetchUpstream(submoduleRepo)
+		if err != nil {
+			log.With(zap.Error(err)).Warn("failed to fetchUpstream")
+		}
+	}
+
+	if opts.Strategy == PullStrategyFetch { // fetch doesn't touch worktree, so it's safe on any branch
+		_, err = runGit(a.getSubmodulePath(submodule), "fetch", "origin")
+		if err != nil {
+			return "", errors.Wrap(err, "failed to fetch")
+		}
+		return PullOutcomeFetched, nil
 	}
 
 	submoduleCurrentBranch, err := a.getSubmoduleCurrentBranch(submodule)
 	if err != nil {
-		return errors.Wrap(err, "failed to getSubmoduleCurrentBranch")
+		return "", errors.Wrap(err, "failed to getSubmoduleCurrentBranch")
 	}
-	// submoduleTrackingBranch gets from .git/config, not from .gitmodules - need to git sync/update or something like that?
+	// submoduleTrackingBranch gets from .git/config, not from .gitmodules - synced by syncSubmodulesTrackingBranches
 	submoduleTrackingBranch := submodule.Config().Branch
-	submoduleDefaultBranch, err := getRepoDefaultBranchName(submoduleRepo)
+	submoduleDefaultBranch, err := a.getSubmoduleDefaultBranch(submodule)
 	if err != nil {
-		return errors.Wrap(err, "failed to getRepoDefaultBranchName")
+		if submoduleTrackingBranch == "" {
+			return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+		}
+		log.With(zap.Error(err)).Debug("failed to getSubmoduleDefaultBranch")
 	}
 
 	log = log.With(
@@ -98,10 +212,16 @@ func (a *App) pullSubmodule(submodule *git.Submodule, log *zap.SugaredLogger) (e
 		"submoduleDefaultBranch", submoduleDefaultBranch,
 	)
 
-	pull := func() (err error) {
+	pull := func() (outcome PullOutcome, err error) {
+		// go-git doesn't support shallow, partial and sparse clones well, git cli keeps them as is
+		if opts.Strategy == PullStrategyRebase || opts.Autostash ||
+			isShallowOrPartial(a.getSubmodulePath(submodule)) || isSparse(a.getSubmodulePath(submodule)) {
+			return pullWithGit(a.getSubmodulePath(submodule), submoduleCurrentBranch, opts, log)
+		}
+
 		submoduleWorktree, err := submoduleRepo.Worktree()
 		if err != nil {
-			return errors.Wrap(err, "failed to submoduleRepo.Worktree")
+			return "", errors.Wrap(err, "failed to submoduleRepo.Worktree")
 		}
 
 		const triesCount = 3
@@ -110,56 +230,239 @@ func (a *App) pullSubmodule(submodule *git.Submodule, log *zap.SugaredLogger) (e
 			err = submoduleWorktree.Pull(&git.PullOptions{RemoteName: "origin"})
 			switch err {
 			case git.NoErrAlreadyUpToDate:
-				return nil
+				return PullOutcomeUpToDate, nil
 			case git.ErrUnstagedChanges:
 				log.Warn("contains unstaged changes, skipping...")
-				return nil
+				return PullOutcomeSkippedDirty, nil
 			case nil:
 				log.Info("pulled new changes")
-				return nil
+				return PullOutcomeUpdated, nil
 			default:
 				err = errors.Wrap(err, "failed to submoduleWorktree.Pull")
 			}
 		}
 
-		return err
+		return "", err
 	}
 
 	switch {
 	case submoduleCurrentBranch == "":
-		return errors.New("missing submoduleCurrentBranch")
+		return "", errors.New("missing submoduleCurrentBranch")
 
 	case submoduleTrackingBranch == "" && submoduleDefaultBranch == "":
-		return errors.New("submoduleTrackingBranch and submoduleDefaultBranch are empty" +
-			". You can try to fix it by 'git symbolic-ref refs/remotes/origin/HEAD refs/remotes/origin/YOUR_DEFAULT_BRANCH'",
+		return "", errors.New("submoduleTrackingBranch and submoduleDefaultBranch are empty" +
+			". You can try to fix it by 'mpcreator repair'",
 		)
 
 	case submoduleTrackingBranch != "": // pull from submoduleTrackingBranch
 		if submoduleTrackingBranch != submoduleCurrentBranch {
+			if opts.UpdateBranches {
+				return a.updateSubmoduleBranches(submodule, submoduleCurrentBranch, submoduleTrackingBranch, log)
+			}
 			log.Warn("submoduleTrackingBranch != submoduleCurrentBranch, skipping...")
-			return nil
+			return PullOutcomeSkippedBranch, nil
 		}
 
-		err = pull()
+		outcome, err = pull()
 		if err != nil {
-			return errors.Wrap(err, "failed to pull submoduleTrackingBranch")
+			return "", errors.Wrap(err, "failed to pull submoduleTrackingBranch")
 		}
 
 	case submoduleDefaultBranch != "": // pull from submoduleDefaultBranch
 		if submoduleDefaultBranch != submoduleCurrentBranch {
+			if opts.UpdateBranches {
+				return a.updateSubmoduleBranches(submodule, submoduleCurrentBranch, submoduleDefaultBranch, log)
+			}
 			log.Warn("submoduleDefaultBranch != submoduleCurrentBranch, skipping...")
-			return nil
+			return PullOutcomeSkippedBranch, nil
 		}
 
-		err = pull()
+		outcome, err = pull()
 		if err != nil {
-			return errors.Wrap(err, "failed to pull submoduleDefaultBranch")
+			return "", errors.Wrap(err, "failed to pull submoduleDefaultBranch")
 		}
 
 	default:
 		log.Panic("unexpected case")
 	}
 
+	return outcome, nil
+}
+
+// pullWithGit pulls branch using git cli (go-git doesn't support rebase and autostash).
+// Rebase conflicts are aborted, so repo stays in the state it was before pull.
+func pullWithGit(repoPath, branch string, opts PullOptions, log *zap.SugaredLogger) (outcome PullOutcome, err error) {
+	if !opts.Autostash {
+		dirty, err := isWorktreeDirty(repoPath)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to isWorktreeDirty")
+		}
+		if dirty {
+			log.Warn("contains uncommitted changes, skipping...")
+			return PullOutcomeSkippedDirty, nil
+		}
+	}
+
+	headBefore, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+
+	args := []string{"pull"}
+	if opts.Strategy == PullStrategyRebase {
+		args = append(args, "--rebase")
+	} else {
+		args = append(args, "--ff-only")
+	}
+	if opts.Autostash {
+		args = append(args, "--autostash")
+	}
+	args = append(args, "origin", branch)
+
+	_, pullErr := runGit(repoPath, args...)
+	if pullErr != nil {
+		if opts.Strategy != PullStrategyRebase {
+			return "", errors.Wrap(pullErr, "failed to pull")
+		}
+
+		// rebase --abort also applies autostash back
+		_, err = runGit(repoPath, "rebase", "--abort")
+		if err != nil { // there was no rebase in progress - it's not a conflict
+			return "", errors.Wrap(pullErr, "failed to pull --rebase")
+		}
+		log.With(zap.Error(pullErr)).Warn("rebase conflict, aborted")
+		return PullOutcomeConflictAborted, nil
+	}
+
+	headAfter, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+	if headAfter == headBefore {
+		return PullOutcomeUpToDate, nil
+	}
+
+	if opts.Strategy == PullStrategyRebase {
+		localCommits, err := runGit(repoPath, "rev-list", "--count", "origin/"+branch+"..HEAD")
+		if err != nil {
+			return "", errors.Wrap(err, "failed to count local commits")
+		}
+		if localCommits != "0" {
+			return PullOutcomeRebased, nil
+		}
+	}
+
+	return PullOutcomeUpdated, nil
+}
+
+// updateSubmoduleBranches fetches origin and fast-forwards local mainBranch and all local branches
+// with upstream on origin, except the checked out currentBranch (worktree is not touched)
+func (a *App) updateSubmoduleBranches(
+	submodule *git.Submodule,
+	currentBranch, mainBranch string,
+	log *zap.SugaredLogger,
+) (outcome PullOutcome, err error) {
+	repoPath := a.getSubmodulePath(submodule)
+
+	_, err = runGit(repoPath, "fetch", "origin")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch")
+	}
+
+	// branch -> upstream
+	branches := map[string]string{}
+	refs, err := runGit(repoPath, "for-each-ref", "--format=%(refname:short) %(upstream:short)", "refs/heads")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to for-each-ref")
+	}
+	for _, line := range strings.Split(refs, "\n") {
+		branch, upstream, _ := strings.Cut(line, " ")
+		if branch == "" || branch == currentBranch {
+			continue
+		}
+		if branch == mainBranch && upstream == "" {
+			upstream = "origin/" + mainBranch
+		}
+		if !strings.HasPrefix(upstream, "origin/") {
+			continue
+		}
+		branches[branch] = upstream
+	}
+
+	updated, diverged := []string{}, []string{}
+	for branch, upstream := range branches {
+		branchSHA, err := runGit(repoPath, "rev-parse", "refs/heads/"+branch)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to rev-parse branch")
+		}
+		upstreamSHA, err := runGit(repoPath, "rev-parse", "--verify", "-q", "refs/remotes/"+upstream)
+		if err != nil { // upstream branch is deleted
+			continue
+		}
+		if branchSHA == upstreamSHA {
+			continue
+		}
+
+		_, err = runGit(repoPath, "merge-base", "--is-ancestor", branchSHA, upstreamSHA)
+		if err != nil { // not fast-forward
+			diverged = append(diverged, branch)
+			continue
+		}
+
+		_, err = runGit(repoPath, "update-ref", "refs/heads/"+branch, upstreamSHA, branchSHA)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to update-ref %s", branch)
+		}
+		updated = append(updated, branch)
+	}
+
+	if len(updated) != 0 {
+		log.With("updatedBranches", updated).Info("fast-forwarded local branches")
+	}
+	if len(diverged) != 0 {
+		log.With("divergedBranches", diverged).Warn("some branches can't be fast-forwarded")
+	}
+
+	return PullOutcomeBranchesUpdated, nil
+}
+
+// isShallowOrPartial returns true if repo is a shallow or partial (--filter) clone
+func isShallowOrPartial(repoPath string) bool {
+	shallow, _ := runGit(repoPath, "rev-parse", "--is-shallow-repository")
+	promisor, _ := runGit(repoPath, "config", "--get", "remote.origin.promisor")
+	return shallow == "true" || promisor == "true"
+}
+
+// isWorktreeDirty returns true if repo has uncommitted changes in tracked files
+func isWorktreeDirty(repoPath string) (dirty bool, err error) {
+	status, err := runGit(repoPath, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return false, errors.Wrap(err, "failed to git status")
+	}
+
+	return status != "", nil
+}
+
+func isArchivedSubmodule(submodule *git.Submodule) bool {
+	return strings.HasPrefix(submodule.Config().Path, ArchiveDir+"/")
+}
+
+// fetchUpstream fetches UpstreamRemoteName remote if repo has it
+func fetchUpstream(repo *git.Repository) (err error) {
+	_, err = repo.Remote(UpstreamRemoteName)
+	switch err {
+	case git.ErrRemoteNotFound:
+		return nil
+	case nil:
+	default:
+		return errors.Wrap(err, "failed to repo.Remote")
+	}
+
+	err = repo.Fetch(&git.FetchOptions{RemoteName: UpstreamRemoteName})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return errors.Wrap(err, "failed to repo.Fetch")
+	}
+
 	return nil
 }
 
@@ -207,3 +510,79 @@ func getRepoDefaultBranchName(repo *git.Repository) (name string, err error) {
 
 	return name, nil
 }
+
+// getSubmoduleDefaultBranch returns default branch of submodule from origin/HEAD.
+// If origin/HEAD is missing - from gitlab project or (if gitlab is not available) from remote HEAD (git ls-remote).
+// Use RepairSubmodulesOriginHead to write missing origin/HEAD.
+func (a *App) getSubmoduleDefaultBranch(submodule *git.Submodule) (defaultBranch string, err error) {
+	// not submodule.Repository() because it randomly throws error
+	submoduleRepo, err := git.PlainOpen(a.getSubmodulePath(submodule))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to submodule.Repository")
+	}
+
+	defaultBranch, err = getRepoDefaultBranchName(submoduleRepo)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to getRepoDefaultBranchName")
+	}
+	if defaultBranch != "" {
+		return defaultBranch, nil
+	}
+
+	return a.resolveSubmoduleDefaultBranch(submodule)
+}
+
+// resolveSubmoduleDefaultBranch returns default branch of submodule from gitlab project
+// or (if gitlab is not available) from remote HEAD (git ls-remote), without local origin/HEAD
+func (a *App) resolveSubmoduleDefaultBranch(submodule *git.Submodule) (defaultBranch string, err error) {
+	defaultBranch, gitlabErr := a.getGitlabDefaultBranch(submodule.Config().URL)
+	if gitlabErr == nil {
+		return defaultBranch, nil
+	}
+
+	defaultBranch, err = getRemoteDefaultBranchName(a.getSubmodulePath(submodule))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to getRemoteDefaultBranchName (after failed getGitlabDefaultBranch: %s)", gitlabErr)
+	}
+
+	return defaultBranch, nil
+}
+
+// getGitlabDefaultBranch returns DefaultBranch of gitlab project by it's remote url
+func (a *App) getGitlabDefaultBranch(remoteURL string) (defaultBranch string, err error) {
+	if a.gitlabClient == nil { // e.g. main project filled from manifest
+		return "", errors.New("gitlab api is not available")
+	}
+	projectPath, err := a.gitlabProjectPath(remoteURL)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to gitlabProjectPath")
+	}
+	project, _, err := a.gitlabClient.Projects.GetProject(projectPath, &gitlab.GetProjectOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to GetProject %s", projectPath)
+	}
+	if project.DefaultBranch == "" {
+		return "", errors.Errorf("missing default branch of project %q", projectPath)
+	}
+
+	return project.DefaultBranch, nil
+}
+
+// getRemoteDefaultBranchName returns branch pointed by HEAD of origin (git ls-remote --symref)
+func getRemoteDefaultBranchName(repoPath string) (name string, err error) {
+	out, err := runGit(repoPath, "ls-remote", "--symref", "origin", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to ls-remote")
+	}
+
+	// ref: refs/heads/main	HEAD
+	for _, line := range strings.Split(out, "\n") {
+		if !strings.HasPrefix(line, "ref: ") {
+			continue
+		}
+		ref, _, _ := strings.Cut(strings.TrimPrefix(line, "ref: "), "\t")
+		return strings.TrimPrefix(ref, "refs/heads/"), nil
+	}
+
+	return "", errors.New("origin HEAD is not a symbolic ref")
+}
@@ -0,0 +1,383 @@
+package app
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"github.com/xanzy/go-gitlab"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+	"golang.org/x/sync/errgroup"
+)
+
+// RemapOptions - options for RemapRemotes
+type RemapOptions struct {
+	From   string // url prefix to replace e.g. "git@gitlab.old.ru:"
+	To     string // new url prefix e.g. "ssh://git@git.company.ru:2222/"
+	DryRun bool   // only log what would be changed
+}
+
+// remapURL replaces prefix from of remoteURL with to (the same way as git url.<base>.insteadOf)
+func remapURL(remoteURL, from, to string) (remapped string, changed bool) {
+	if from == "" || !strings.HasPrefix(remoteURL, from) {
+		return remoteURL, false
+	}
+
+	remapped = to + strings.TrimPrefix(remoteURL, from)
+	return remapped, remapped != remoteURL
+}
+
+// RemapRemotes rewrites urls of the selected submodules consistently:
+// in .gitmodules, in .git/config of the main project and "origin" remote of the submodule
+func (a *App) RemapRemotes(filter Filter, opts RemapOptions) (err error) {
+	a.log.With(
+		"filter", filter,
+		"opts", opts,
+	).Info("RemapRemotes")
+
+	if opts.From == "" {
+		return errors.New("empty from pattern")
+	}
+	if opts.To == "" { // otherwise urls become relative paths
+		return errors.New("empty to pattern")
+	}
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	remapped := 0
+	for _, submodule := range submodules {
+		log := a.log.With("submodule", submodule.Config().Path)
+
+		urls, err := a.getSubmoduleURLs(submodule)
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to getSubmoduleURLs")
+			continue
+		}
+
+		newURL, changed := "", false
+		for _, url := range urls.distinct() {
+			if newURL, changed = remapURL(url, opts.From, opts.To); changed {
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+		remapped++
+
+		log = log.With("urls", urls.distinct(), "newURL", newURL)
+		if opts.DryRun {
+			log.Info("dry run: submodule url would be remapped")
+			continue
+		}
+
+		err = a.setSubmoduleURL(submodule, newURL)
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to setSubmoduleURL")
+			continue
+		}
+		log.Info("submodule url remapped")
+	}
+
+	a.log.With("remapped", remapped, "dryRun", opts.DryRun).Info("RemapRemotes done")
+
+	return nil
+}
+
+// submoduleURLs - urls of the submodule, Config and Origin are empty if submodule is not initialized / cloned
+type submoduleURLs struct {
+	Gitmodules string
+	Config     string
+	Origin     string
+}
+
+// distinct returns distinct not empty urls
+func (u submoduleURLs) distinct() (urls []string) {
+	for _, url := range []string{u.Gitmodules, u.Config, u.Origin} {
+		if url != "" && !slices.Contains(urls, url) {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// remote returns url actually used for fetch / push
+func (u submoduleURLs) remote() string {
+	if u.Origin != "" {
+		return u.Origin
+	}
+	return u.Gitmodules
+}
+
+// getSubmoduleURLs returns urls of the submodule: from .gitmodules, .git/config and "origin" remote
+func (a *App) getSubmoduleURLs(submodule *git.Submodule) (urls submoduleURLs, err error) {
+	key := "submodule." + submodule.Config().Name + ".url"
+
+	urls.Gitmodules, err = runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, "--get", key)
+	if err != nil {
+		return submoduleURLs{}, errors.Wrap(err, "failed to get url from "+gitmodulesFile)
+	}
+	urls.Config, _ = runGit(a.mainProjectPath, "config", "--get", key) // error if submodule is not initialized
+	if _, err = os.Stat(a.getSubmodulePath(submodule) + "/.git"); err == nil {
+		urls.Origin, _ = runGit(a.getSubmodulePath(submodule), "remote", "get-url", "origin")
+	}
+
+	return urls, nil
+}
+
+// setSubmoduleURL writes url of the submodule to .gitmodules, .git/config of main project (if submodule is initialized)
+// and "origin" remote of the submodule (if it is cloned)
+func (a *App) setSubmoduleURL(submodule *git.Submodule, url string) (err error) {
+	key := "submodule." + submodule.Config().Name + ".url"
+
+	_, err = runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, key, url)
+	if err != nil {
+		return errors.Wrap(err, "failed to write url to "+gitmodulesFile)
+	}
+
+	if _, err = runGit(a.mainProjectPath, "config", "--get", key); err == nil {
+		_, err = runGit(a.mainProjectPath, "config", key, url)
+		if err != nil {
+			return errors.Wrap(err, "failed to write url to .git/config")
+		}
+	}
+
+	if _, err = os.Stat(a.getSubmodulePath(submodule) + "/.git"); err == nil {
+		_, err = runGit(a.getSubmodulePath(submodule), "remote", "set-url", "origin", url)
+		if err != nil {
+			return errors.Wrap(err, "failed to remote set-url origin")
+		}
+	}
+
+	return nil
+}
+
+// RemotesCheck - how fill handles submodules which remote drifted from the gitlab project
+type RemotesCheck string
+
+const (
+	RemotesCheckOff    RemotesCheck = "off"
+	RemotesCheckReport RemotesCheck = "report"
+	RemotesCheckFix    RemotesCheck = "fix"
+)
+
+// submodulesByProjectID returns paths of the submodules of the main project by ID of the gitlab project.
+// The project is found by the path from the remote url, gitlab redirects old paths of renamed / moved projects.
+// Submodules not found in gitlab are skipped.
+func (a *App) submodulesByProjectID(
+	mainProjectRepo *git.Repository,
+	gitmodulesMu *sync.Mutex, // git config can't be written concurrently
+) (paths map[int][]string, err error) {
+	wt, err := mainProjectRepo.Worktree()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get Worktree")
+	}
+	gitmodulesMu.Lock()
+	submodules, err := wt.Submodules()
+	gitmodulesMu.Unlock()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get Submodules")
+	}
+
+	paths = map[int][]string{}
+	var mu sync.Mutex
+	var g errgroup.Group
+	g.SetLimit(8)
+	for _, submodule := range submodules {
+		submodule := submodule
+		g.Go(func() error {
+			log := a.log.With("submodule", submodule.Config().Path)
+
+			urls, err := a.getSubmoduleURLs(submodule)
+			if err != nil {
+				log.With(zap.Error(err)).Debug("failed to getSubmoduleURLs")
+				return nil
+			}
+			projectID, err := a.getProjectIDByURL(urls.remote())
+			if err != nil {
+				log.With(zap.Error(err)).Debug("gitlab project is not found by remote url")
+				return nil
+			}
+
+			mu.Lock()
+			paths[projectID] = append(paths[projectID], submodule.Config().Path)
+			mu.Unlock()
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	for _, projectPaths := range paths {
+		sort.Strings(projectPaths)
+	}
+
+	return paths, nil
+}
+
+// isExcludedHost returns true if host is one of excludeHosts or their subdomain
+func isExcludedHost(host string, excludeHosts []string) bool {
+	for _, excludeHost := range excludeHosts {
+		if isSameHost(host, excludeHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectSubmodules finds existing submodules of renamed / moved projects by project ID (see submodulesByProjectID).
+// The index is built on the first project without submodule at it's path, so while all projects are
+// at their paths fill makes no extra gitlab calls.
+type projectSubmodules struct {
+	app             *App
+	mainProjectRepo *git.Repository
+	gitmodulesMu    *sync.Mutex
+
+	once sync.Once
+	byID map[int][]string
+	err  error
+}
+
+// movedPath returns path of the existing submodule of the renamed / moved project,
+// "" if there is a submodule at projectPath or the project has no submodule
+func (s *projectSubmodules) movedPath(projectID int, projectPath string) (oldPath string, err error) {
+	wt, err := s.mainProjectRepo.Worktree()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get Worktree")
+	}
+	s.gitmodulesMu.Lock()
+	_, err = wt.Submodule(projectPath)
+	s.gitmodulesMu.Unlock()
+	if err == nil {
+		return "", nil
+	}
+	if !errors.Is(err, git.ErrSubmoduleNotFound) {
+		return "", errors.Wrap(err, "failed to wt.Submodule")
+	}
+
+	s.once.Do(func() {
+		s.byID, s.err = s.app.submodulesByProjectID(s.mainProjectRepo, s.gitmodulesMu)
+	})
+	if s.err != nil {
+		return "", errors.Wrap(s.err, "failed to submodulesByProjectID")
+	}
+
+	return movedSubmodulePath(s.byID[projectID], projectPath), nil
+}
+
+// movedSubmodulePath returns path of the existing submodule of the renamed / moved project,
+// "" if the project has no submodule or one of them is already at projectPath
+func movedSubmodulePath(submodulePaths []string, projectPath string) string {
+	if len(submodulePaths) == 0 || slices.Contains(submodulePaths, projectPath) {
+		return ""
+	}
+	return submodulePaths[0]
+}
+
+// checkProjectRemote compares urls of the project submodule with SSHURLToRepo of the project,
+// drift is reported or (RemotesCheckFix) fixed.
+// Drift happens e.g. when the project is renamed / moved (gitlab redirects old urls) or the remote is switched to https.
+func (a *App) checkProjectRemote(
+	submodule *git.Submodule,
+	project *gitlab.Project,
+	mode RemotesCheck,
+	gitmodulesMu *sync.Mutex, // git config can't be written concurrently
+	log *zap.SugaredLogger,
+) (err error) {
+	if mode == RemotesCheckOff || mode == "" {
+		return nil
+	}
+
+	urls, err := a.getSubmoduleURLs(submodule)
+	if err != nil {
+		return errors.Wrap(err, "failed to getSubmoduleURLs")
+	}
+	expectedURL := project.SSHURLToRepo
+	if expectedURL == "" {
+		return nil
+	}
+	distinct := urls.distinct()
+	if len(distinct) == 1 && distinct[0] == expectedURL {
+		return nil
+	}
+
+	log = log.With("urls", distinct, "expectedURL", expectedURL, "projectID", project.ID)
+	if mode != RemotesCheckFix {
+		log.Warn("submodule remote differs from gitlab project, fix it with --doctor-remotes fix")
+		return nil
+	}
+
+	gitmodulesMu.Lock()
+	err = a.setSubmoduleURL(submodule, expectedURL)
+	gitmodulesMu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "failed to setSubmoduleURL")
+	}
+	log.Info("submodule remote updated from gitlab project")
+
+	return nil
+}
+
+// CheckRemotes reports selected submodules which "origin" remote doesn't match SSHURLToRepo of the gitlab project
+// (the project is found by the path from the remote url). Remotes on other hosts (e.g. not remapped after
+// gitlab migration) are mismatched too, except excludeHosts (e.g. "github.com" for repos added from manifest).
+func (a *App) CheckRemotes(filter Filter, excludeHosts []string) (err error) {
+	a.log.With("filter", filter, "excludeHosts", excludeHosts).Info("CheckRemotes")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	var mismatched []string
+	for _, submodule := range submodules {
+		log := a.log.With("submodule", submodule.Config().Path)
+
+		urls, err := a.getSubmoduleURLs(submodule)
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to getSubmoduleURLs")
+			continue
+		}
+		remoteURL := urls.remote()
+
+		projectPath, err := a.gitlabProjectPath(remoteURL)
+		if errors.Is(err, errNotGitlabURL) {
+			if isExcludedHost(remoteURLHost(remoteURL), excludeHosts) {
+				log.With("remoteURL", remoteURL).Debug("remote host is excluded, skipping")
+				continue
+			}
+			log.With("remoteURL", remoteURL).Warn("remote is not on the gitlab host")
+			mismatched = append(mismatched, submodule.Config().Path)
+			continue
+		}
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to gitlabProjectPath")
+			continue
+		}
+		project, _, err := a.gitlabClient.Projects.GetProject(projectPath, nil)
+		if err != nil {
+			log.With("remoteURL", remoteURL, "error", err.Error()).Warn("gitlab project is not found by remote url")
+			mismatched = append(mismatched, submodule.Config().Path)
+			continue
+		}
+
+		if len(urls.distinct()) != 1 || remoteURL != project.SSHURLToRepo {
+			log.With("urls", urls.distinct(), "sshURLToRepo", project.SSHURLToRepo).Warn("remote doesn't match gitlab")
+			mismatched = append(mismatched, submodule.Config().Path)
+		}
+	}
+
+	sort.Strings(mismatched)
+	if len(mismatched) != 0 {
+		a.log.With("submodules", mismatched).Warn("remotes not matching gitlab, fix them with remap-remotes")
+	}
+	a.log.With("checked", len(submodules), "mismatched", len(mismatched)).Info("CheckRemotes done")
+
+	return nil
+}
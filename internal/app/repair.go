@@ -0,0 +1,86 @@
+package app
+
+import (
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// RepairSubmodulesOriginHead writes missing refs/remotes/origin/HEAD for all selected submodules,
+// default branch is resolved by resolveSubmoduleDefaultBranch (gitlab or git ls-remote)
+func (a *App) RepairSubmodulesOriginHead(filter Filter) (err error) {
+	a.log.With("filter", filter).Info("RepairSubmodulesOriginHead")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	repaired := 0
+	for _, submodule := range submodules {
+		ok, err := a.repairSubmoduleOriginHead(submodule, a.log)
+		if err != nil {
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to repairSubmoduleOriginHead")
+
+			continue
+		}
+		if ok {
+			repaired++
+		}
+	}
+
+	a.log.With("repaired", repaired).Info("RepairSubmodulesOriginHead done")
+
+	return nil
+}
+
+// repairSubmoduleOriginHead writes refs/remotes/origin/HEAD if it is missing (repaired == true)
+func (a *App) repairSubmoduleOriginHead(submodule *git.Submodule, log *zap.SugaredLogger) (repaired bool, err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	repoPath := a.getSubmodulePath(submodule)
+
+	// not submodule.Repository() because it randomly throws error
+	submoduleRepo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to submodule.Repository")
+	}
+
+	submoduleDefaultBranch, err := getRepoDefaultBranchName(submoduleRepo)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to getRepoDefaultBranchName")
+	}
+	if submoduleDefaultBranch != "" {
+		log.Debug("origin/HEAD exists")
+		return false, nil
+	}
+
+	submoduleDefaultBranch, err = a.resolveSubmoduleDefaultBranch(submodule)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to resolveSubmoduleDefaultBranch")
+	}
+	log = log.With("submoduleDefaultBranch", submoduleDefaultBranch)
+
+	exists, err := branchExists(repoPath, submoduleDefaultBranch)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to branchExists")
+	}
+	if !exists {
+		_, err = runGit(repoPath, "fetch", "origin")
+		if err != nil {
+			return false, errors.Wrap(err, "failed to fetch")
+		}
+	}
+
+	// checks that refs/remotes/origin/<branch> exists
+	_, err = runGit(repoPath, "remote", "set-head", "origin", submoduleDefaultBranch)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to remote set-head")
+	}
+
+	log.Info("origin/HEAD repaired")
+
+	return true, nil
+}
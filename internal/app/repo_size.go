@@ -0,0 +1,177 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/hashicorp/go-retryablehttp"
+	"github.com/pkg/errors"
+	"github.com/xanzy/go-gitlab"
+)
+
+// LargeReposMode - how to handle repositories above SizeLimit.MaxRepoSize
+type LargeReposMode string
+
+const (
+	LargeReposSkip    LargeReposMode = "skip"
+	LargeReposShallow LargeReposMode = "shallow"
+)
+
+// SizeLimit - limits for large repositories and size reporting for FillMainProject
+type SizeLimit struct {
+	MaxRepoSize int64 // bytes, 0 - no limit
+	LargeRepos  LargeReposMode
+
+	Report bool // print size report (gitlab repository size of added repos per group) at the end of fill
+}
+
+// needStatistics returns true if project statistics are required
+func (l SizeLimit) needStatistics() bool {
+	return l.MaxRepoSize > 0 || l.Report
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	// longest suffixes first
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses human readable size e.g. "500MB", "1.5G", "1024"
+func ParseSize(s string) (size int64, err error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to strconv.ParseFloat")
+	}
+	if value < 0 {
+		return 0, errors.New("size can't be negative")
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// formatSize formats size in bytes to human readable form e.g. "1.5GB"
+func formatSize(size int64) string {
+	for _, unit := range sizeUnits[:4] {
+		if size >= unit.size {
+			return strconv.FormatFloat(float64(size)/float64(unit.size), 'f', 1, 64) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10) + "B"
+}
+
+// withStatistics adds statistics=true to list projects requests (ListGroupProjectsOptions has no such option),
+// so getProjectRepoSize doesn't need GetProject for every project
+func withStatistics() gitlab.RequestOptionFunc {
+	return func(req *retryablehttp.Request) error {
+		query := req.URL.Query()
+		query.Set("statistics", "true")
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+}
+
+// getProjectRepoSize returns repository size of the project from gitlab statistics,
+// returns 0 if statistics is not available (e.g. not enough access rights)
+func (a *App) getProjectRepoSize(project *gitlab.Project) (size int64, err error) {
+	statistics := project.Statistics
+	if statistics == nil {
+		projectWithStatistics, _, err := a.gitlabClient.Projects.GetProject(project.ID, &gitlab.GetProjectOptions{
+			Statistics: pointerToVar(true),
+		})
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to GetProject for project.ID %d", project.ID)
+		}
+		if projectWithStatistics.Statistics == nil {
+			return 0, nil
+		}
+		statistics = projectWithStatistics.Statistics
+	}
+
+	return statistics.RepositorySize, nil
+}
+
+// sizeReport - gitlab repository size (full, not what was fetched by shallow / partial clone) of added repos per group
+type sizeReport struct {
+	mu     sync.Mutex
+	groups map[string]*sizeReportGroup
+}
+
+type sizeReportGroup struct {
+	projects int
+	bytes    int64
+}
+
+func newSizeReport() *sizeReport {
+	return &sizeReport{groups: map[string]*sizeReportGroup{}}
+}
+
+func (r *sizeReport) add(group string, size int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	g, ok := r.groups[group]
+	if !ok {
+		g = &sizeReportGroup{}
+		r.groups[group] = g
+	}
+	g.projects++
+	g.bytes += size
+}
+
+func (r *sizeReport) print(w io.Writer) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	groups := make([]string, 0, len(r.groups))
+	for group := range r.groups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GROUP\tADDED\tREPO SIZE")
+	total := sizeReportGroup{}
+	for _, group := range groups {
+		g := r.groups[group]
+		total.projects += g.projects
+		total.bytes += g.bytes
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", group, g.projects, formatSize(g.bytes))
+	}
+	fmt.Fprintf(tw, "TOTAL\t%d\t%s\n", total.projects, formatSize(total.bytes))
+
+	err = tw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to tw.Flush")
+	}
+
+	return nil
+}
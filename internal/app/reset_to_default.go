@@ -0,0 +1,149 @@
+package app
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// ResetOutcome - result of resetSubmoduleToDefault
+type ResetOutcome string
+
+const (
+	ResetOutcomeReset           ResetOutcome = "reset"
+	ResetOutcomeUpToDate        ResetOutcome = "up-to-date"
+	ResetOutcomeDiverged        ResetOutcome = "diverged"
+	ResetOutcomeSkippedDirty    ResetOutcome = "skipped-dirty"
+	ResetOutcomeSkippedUnpushed ResetOutcome = "skipped-unpushed"
+	ResetOutcomeFailed          ResetOutcome = "failed"
+)
+
+// ResetSubmodulesToDefault switches all selected submodules with clean worktree to their default branch
+// and fast-forwards it. Submodules with uncommitted changes or unpushed commits are left alone.
+func (a *App) ResetSubmodulesToDefault(filter Filter) (err error) {
+	a.log.With("filter", filter).Info("ResetSubmodulesToDefault")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	outcomes := map[ResetOutcome][]string{}
+	for _, submodule := range submodules {
+		if isArchivedSubmodule(submodule) { // archived projects can't change
+			continue
+		}
+
+		outcome, err := a.resetSubmoduleToDefault(submodule, a.log)
+		if err != nil {
+			outcome = ResetOutcomeFailed
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to resetSubmoduleToDefault")
+		}
+		outcomes[outcome] = append(outcomes[outcome], submodule.Config().Path)
+	}
+
+	for _, outcome := range []ResetOutcome{ResetOutcomeSkippedDirty, ResetOutcomeSkippedUnpushed, ResetOutcomeDiverged} {
+		if len(outcomes[outcome]) == 0 {
+			continue
+		}
+		sort.Strings(outcomes[outcome])
+		a.log.With("reason", outcome, "submodules", outcomes[outcome]).Warn("submodules left alone")
+	}
+
+	counts := make(map[ResetOutcome]int, len(outcomes))
+	for outcome, paths := range outcomes {
+		counts[outcome] = len(paths)
+	}
+	a.log.With("outcomes", counts).Info("ResetSubmodulesToDefault done")
+
+	return nil
+}
+
+func (a *App) resetSubmoduleToDefault(submodule *git.Submodule, log *zap.SugaredLogger) (outcome ResetOutcome, err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	log.Debug("resetting submodule to default branch...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("resetting submodule done")
+		}
+	}()
+
+	repoPath := a.getSubmodulePath(submodule)
+
+	dirty, err := isWorktreeDirty(repoPath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to isWorktreeDirty")
+	}
+	if dirty {
+		return ResetOutcomeSkippedDirty, nil
+	}
+
+	_, err = runGit(repoPath, "fetch", "origin")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch")
+	}
+
+	unpushed, err := runGit(repoPath, "rev-list", "--count", "HEAD", "--not", "--remotes")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to count unpushed commits")
+	}
+	if unpushed != "0" {
+		log.With("unpushedCommits", unpushed).Debug("contains unpushed commits")
+		return ResetOutcomeSkippedUnpushed, nil
+	}
+
+	submoduleCurrentBranch, err := a.getSubmoduleCurrentBranch(submodule)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to getSubmoduleCurrentBranch")
+	}
+	submoduleDefaultBranch, err := a.getSubmoduleDefaultBranch(submodule)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+	}
+	log = log.With(
+		"submoduleCurrentBranch", submoduleCurrentBranch,
+		"submoduleDefaultBranch", submoduleDefaultBranch,
+	)
+
+	headBefore, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+
+	// check before switch, otherwise diverged submodule would be left on the default branch
+	branchSHA, err := runGit(repoPath, "rev-parse", "--verify", "-q", "refs/heads/"+submoduleDefaultBranch)
+	if err == nil { // local default branch exists (otherwise switch creates it from origin)
+		_, err = runGit(repoPath, "merge-base", "--is-ancestor", branchSHA, "refs/remotes/origin/"+submoduleDefaultBranch)
+		if err != nil {
+			log.With(zap.Error(err)).Warn("local default branch can't be fast-forwarded")
+			return ResetOutcomeDiverged, nil
+		}
+	}
+
+	if submoduleCurrentBranch != submoduleDefaultBranch {
+		_, err = runGit(repoPath, "switch", submoduleDefaultBranch)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to switch")
+		}
+	}
+
+	_, err = runGit(repoPath, "merge", "--ff-only", "origin/"+submoduleDefaultBranch)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to merge --ff-only")
+	}
+
+	headAfter, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+	if headAfter == headBefore {
+		return ResetOutcomeUpToDate, nil
+	}
+
+	return ResetOutcomeReset, nil
+}
@@ -0,0 +1,295 @@
+package app
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// ReportStatus - result of fill / pull for one project
+type ReportStatus string
+
+const (
+	ReportStatusAdded    ReportStatus = "added"      // fill: submodule added (cloned or adopted)
+	ReportStatusExisted  ReportStatus = "existed"    // fill: submodule already exists
+	ReportStatusUpdated  ReportStatus = "updated"    // pull: new commits pulled / fetched
+	ReportStatusUpToDate ReportStatus = "up-to-date" // pull: nothing to pull
+	ReportStatusSkipped  ReportStatus = "skipped"
+	ReportStatusFailed   ReportStatus = "failed"
+)
+
+// FailOn - which project results make fill / pull fail (non-zero exit code)
+type FailOn string
+
+const (
+	FailOnFailed  FailOn = "failed"  // any project failed
+	FailOnSkipped FailOn = "skipped" // any project failed or skipped
+	FailOnNever   FailOn = "never"   // only errors of the whole run (e.g. gitlab api is unavailable)
+)
+
+// ReportOptions - where to write the run report (the table is always printed at the end) and when to fail
+type ReportOptions struct {
+	File   string // .json or .xml (JUnit), "" - don't write
+	FailOn FailOn
+}
+
+// Validate checks ReportOptions before the run
+func (o ReportOptions) Validate() (err error) {
+	switch strings.ToLower(filepath.Ext(o.File)) {
+	case "", ".json", ".xml":
+	default:
+		return errors.Errorf("unknown report format %q, use .json or .xml (JUnit)", o.File)
+	}
+
+	return nil
+}
+
+// ProjectResult - result of fill / pull for one project
+type ProjectResult struct {
+	Path    string       `json:"path"`
+	Status  ReportStatus `json:"status"`
+	Details string       `json:"details,omitempty"` // skip reason, pull outcome
+	Error   string       `json:"error,omitempty"`
+	Seconds float64      `json:"seconds"`
+}
+
+// runReport - per project results of fill / pull
+type runReport struct {
+	Command   string               `json:"command"`
+	StartedAt time.Time            `json:"startedAt"`
+	Seconds   float64              `json:"seconds"`
+	Counts    map[ReportStatus]int `json:"counts"`
+	Results   []ProjectResult      `json:"results"`
+
+	mu sync.Mutex
+}
+
+func newRunReport(command string) *runReport {
+	return &runReport{Command: command, StartedAt: time.Now()}
+}
+
+// add adds result of the project, status is ReportStatusFailed if err != nil
+func (r *runReport) add(projectPath string, status ReportStatus, details string, err error, started time.Time) {
+	if details == string(status) { // e.g. pull outcome "up-to-date"
+		details = ""
+	}
+	result := ProjectResult{
+		Path:    projectPath,
+		Status:  status,
+		Details: details,
+		Seconds: time.Since(started).Seconds(),
+	}
+	if err != nil {
+		result.Status = ReportStatusFailed
+		result.Error = err.Error()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Results = append(r.Results, result)
+}
+
+// finish sorts results, prints them as a table and writes the report file
+func (r *runReport) finish(w io.Writer, opts ReportOptions) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Seconds = time.Since(r.StartedAt).Seconds()
+	r.Counts = r.counts()
+	sort.Slice(r.Results, func(i, j int) bool { return r.Results[i].Path < r.Results[j].Path })
+
+	err = r.print(w)
+	if err != nil {
+		return errors.Wrap(err, "failed to print")
+	}
+
+	if opts.File == "" {
+		return nil
+	}
+	var data []byte
+	switch strings.ToLower(filepath.Ext(opts.File)) {
+	case ".xml":
+		data, err = xml.MarshalIndent(r.junit(), "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to xml.MarshalIndent")
+		}
+		data = append([]byte(xml.Header), data...)
+	default:
+		data, err = json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to json.MarshalIndent")
+		}
+	}
+
+	err = os.WriteFile(opts.File, append(data, '\n'), 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to os.WriteFile")
+	}
+
+	return nil
+}
+
+// paths returns paths of the projects of the report with one of statuses, all if statuses are empty
+func (r *runReport) paths(statuses ...ReportStatus) (paths []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	paths = make([]string, 0, len(r.Results))
+	for _, result := range r.Results {
+		if len(statuses) != 0 && !slices.Contains(statuses, result.Status) {
+			continue
+		}
+		paths = append(paths, result.Path)
+	}
+	return paths
+}
+
+func (r *runReport) counts() (counts map[ReportStatus]int) {
+	counts = map[ReportStatus]int{}
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+func (r *runReport) print(w io.Writer) (err error) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROJECT\tSTATUS\tDETAILS")
+	for _, result := range r.Results {
+		details := result.Details
+		if result.Error != "" {
+			details = result.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Path, result.Status, details)
+	}
+
+	counts := r.counts()
+	statuses := make([]string, 0, len(counts))
+	for status, count := range counts {
+		statuses = append(statuses, fmt.Sprintf("%s: %d", status, count))
+	}
+	sort.Strings(statuses)
+	fmt.Fprintf(tw, "TOTAL %d\t%s\t\n", len(r.Results), strings.Join(statuses, ", "))
+
+	err = tw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to tw.Flush")
+	}
+
+	return nil
+}
+
+// check returns error if results violate the FailOn policy
+func (r *runReport) check(failOn FailOn) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := r.counts()
+	switch failOn {
+	case FailOnNever:
+		return nil
+	case FailOnSkipped:
+		if counts[ReportStatusFailed]+counts[ReportStatusSkipped] > 0 {
+			return errors.Errorf("%s: %d projects failed, %d skipped",
+				r.Command, counts[ReportStatusFailed], counts[ReportStatusSkipped])
+		}
+	default:
+		if counts[ReportStatusFailed] > 0 {
+			return errors.Errorf("%s: %d projects failed", r.Command, counts[ReportStatusFailed])
+		}
+	}
+
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+}
+
+// junit returns the report as JUnit XML: test suite per command, test case per project
+func (r *runReport) junit() junitTestSuites {
+	counts := r.counts()
+	suite := junitTestSuite{
+		Name:      "mpcreator " + r.Command,
+		Tests:     len(r.Results),
+		Failures:  counts[ReportStatusFailed],
+		Skipped:   counts[ReportStatusSkipped],
+		Time:      formatSeconds(r.Seconds),
+		Timestamp: r.StartedAt.Format(time.RFC3339),
+	}
+	for _, result := range r.Results {
+		testCase := junitTestCase{
+			Name:      result.Path,
+			Classname: r.Command,
+			Time:      formatSeconds(result.Seconds),
+		}
+		switch result.Status {
+		case ReportStatusFailed:
+			testCase.Failure = &junitMessage{Message: result.Error}
+		case ReportStatusSkipped:
+			testCase.Skipped = &junitMessage{Message: result.Details}
+		default:
+			testCase.SystemOut = string(result.Status)
+			if result.Details != "" {
+				testCase.SystemOut += ": " + result.Details
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	return junitTestSuites{Suites: []junitTestSuite{suite}}
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// pullOutcomeStatus returns ReportStatus of PullOutcome
+func pullOutcomeStatus(outcome PullOutcome) ReportStatus {
+	switch outcome {
+	case PullOutcomeUpToDate:
+		return ReportStatusUpToDate
+	case PullOutcomeUpdated, PullOutcomeRebased, PullOutcomeFetched, PullOutcomeBranchesUpdated:
+		return ReportStatusUpdated
+	case PullOutcomeFailed:
+		return ReportStatusFailed
+	default: // skipped-dirty, skipped-branch, conflict-aborted
+		return ReportStatusSkipped
+	}
+}
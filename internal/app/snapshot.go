@@ -0,0 +1,290 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultLockfile - default path of the lockfile written by Snapshot
+const DefaultLockfile = "mpcreator.lock.json"
+
+// Lockfile - state of the selected repos of the main project (see Snapshot, Restore)
+type Lockfile struct {
+	CreatedAt time.Time    `json:"createdAt"`
+	Repos     []LockedRepo `json:"repos"`
+}
+
+// LockedRepo - state of the repo in Lockfile
+type LockedRepo struct {
+	ProjectID   int       `json:"projectId,omitempty"` // 0 if project is not found in gitlab
+	Path        string    `json:"path"`
+	URL         string    `json:"url"`
+	Branch      string    `json:"branch,omitempty"` // "" if HEAD was detached
+	Commit      string    `json:"commit"`
+	CommittedAt time.Time `json:"committedAt"`
+}
+
+// readLockfile reads Lockfile from the file
+func readLockfile(lockfilePath string) (lockfile Lockfile, err error) {
+	data, err := os.ReadFile(lockfilePath)
+	if err != nil {
+		return Lockfile{}, errors.Wrap(err, "failed to os.ReadFile")
+	}
+	err = json.Unmarshal(data, &lockfile)
+	if err != nil {
+		return Lockfile{}, errors.Wrap(err, "failed to json.Unmarshal")
+	}
+
+	return lockfile, nil
+}
+
+// writeLockfile writes Lockfile to the file
+func writeLockfile(lockfilePath string, lockfile Lockfile) (err error) {
+	data, err := json.MarshalIndent(lockfile, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to json.MarshalIndent")
+	}
+	err = os.WriteFile(lockfilePath, append(data, '\n'), 0o644)
+	if err != nil {
+		return errors.Wrap(err, "failed to os.WriteFile")
+	}
+
+	return nil
+}
+
+// Snapshot writes Lockfile with current commits of the selected submodules.
+// Uncommitted changes and unpushed commits are not restorable, such submodules are reported.
+func (a *App) Snapshot(filter Filter, lockfilePath string) (err error) {
+	a.log.With(
+		"filter", filter,
+		"lockfile", lockfilePath,
+	).Info("Snapshot")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	lockfile := Lockfile{CreatedAt: time.Now().UTC()}
+	var dirty, unpushed []string
+	for _, submodule := range submodules {
+		log := a.log.With("submodule", submodule.Config().Path)
+
+		repo, err := a.lockSubmodule(submodule)
+		if err != nil {
+			log.With(zap.Error(err)).Error("failed to lockSubmodule")
+			continue
+		}
+		lockfile.Repos = append(lockfile.Repos, repo)
+
+		repoPath := a.getSubmodulePath(submodule)
+		isDirty, err := isWorktreeDirty(repoPath)
+		if err != nil {
+			log.With(zap.Error(err)).Warn("failed to isWorktreeDirty")
+		} else if isDirty {
+			dirty = append(dirty, repo.Path)
+		}
+		count, err := runGit(repoPath, "rev-list", "--count", "HEAD", "--not", "--remotes")
+		if err != nil {
+			log.With(zap.Error(err)).Warn("failed to count unpushed commits")
+		} else if count != "0" {
+			unpushed = append(unpushed, repo.Path)
+		}
+	}
+	sort.Slice(lockfile.Repos, func(i, j int) bool { return lockfile.Repos[i].Path < lockfile.Repos[j].Path })
+
+	if len(dirty) != 0 {
+		a.log.With("submodules", dirty).Warn("uncommitted changes are not saved in the lockfile")
+	}
+	if len(unpushed) != 0 {
+		a.log.With("submodules", unpushed).Warn("commits are not pushed, they can't be restored on other machines")
+	}
+
+	err = writeLockfile(lockfilePath, lockfile)
+	if err != nil {
+		return errors.Wrap(err, "failed to writeLockfile")
+	}
+	a.log.With("repos", len(lockfile.Repos)).Info("Snapshot done")
+
+	return nil
+}
+
+// lockSubmodule returns current state of the submodule
+func (a *App) lockSubmodule(submodule *git.Submodule) (repo LockedRepo, err error) {
+	repoPath := a.getSubmodulePath(submodule)
+	repo = LockedRepo{
+		Path: submodule.Config().Path,
+		URL:  submodule.Config().URL,
+	}
+
+	repo.Commit, err = runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return LockedRepo{}, errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+	committedAt, err := runGit(repoPath, "show", "-s", "--format=%ct", "HEAD")
+	if err != nil {
+		return LockedRepo{}, errors.Wrap(err, "failed to get commit time")
+	}
+	unix, err := strconv.ParseInt(committedAt, 10, 64)
+	if err != nil {
+		return LockedRepo{}, errors.Wrap(err, "failed to strconv.ParseInt")
+	}
+	repo.CommittedAt = time.Unix(unix, 0).UTC()
+	repo.Branch, _ = runGit(repoPath, "symbolic-ref", "-q", "--short", "HEAD") // fails if HEAD is detached
+
+	repo.ProjectID, err = a.getProjectIDByURL(repo.URL)
+	if err != nil {
+		a.log.With("submodule", repo.Path, "error", err.Error()).Warn("failed to getProjectIDByURL, project ID is not saved")
+	}
+
+	return repo, nil
+}
+
+// getProjectIDByURL returns ID of the gitlab project by it's remote url
+func (a *App) getProjectIDByURL(remoteURL string) (projectID int, err error) {
+	projectPath, err := a.gitlabProjectPath(remoteURL)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to gitlabProjectPath")
+	}
+	project, _, err := a.gitlabClient.Projects.GetProject(projectPath, nil)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to GetProject for project %s", projectPath)
+	}
+
+	return project.ID, nil
+}
+
+// RestoreOutcome - result of restoreRepo
+type RestoreOutcome string
+
+const (
+	RestoreOutcomeRestored     RestoreOutcome = "restored"
+	RestoreOutcomeCloned       RestoreOutcome = "cloned"
+	RestoreOutcomeAlready      RestoreOutcome = "already"
+	RestoreOutcomeSkippedDirty RestoreOutcome = "skipped-dirty"
+	RestoreOutcomeFailed       RestoreOutcome = "failed"
+)
+
+// Restore clones missing repos from the lockfile and checks out recorded commits (detached HEAD).
+// Repos with uncommitted changes are left alone. Only groups and projects rules of the filter are used.
+func (a *App) Restore(filter Filter, lockfilePath string) (err error) {
+	a.log.With(
+		"filter", filter,
+		"lockfile", lockfilePath,
+	).Info("Restore")
+
+	lockfile, err := readLockfile(lockfilePath)
+	if err != nil {
+		return errors.Wrap(err, "failed to readLockfile")
+	}
+	a.log.With("createdAt", lockfile.CreatedAt).Info("lockfile loaded")
+
+	mainProjectRepo, err := a.initMainProject()
+	if err != nil {
+		return errors.Wrap(err, "failed to initMainProject")
+	}
+
+	outcomes := map[RestoreOutcome][]string{}
+	for _, repo := range lockfile.Repos {
+		if !filter.fullPathPass(repo.Path) {
+			continue
+		}
+
+		outcome, err := a.restoreRepo(mainProjectRepo, repo, a.log)
+		if err != nil {
+			outcome = RestoreOutcomeFailed
+			a.log.With(
+				"submodule", repo.Path,
+				"error", err.Error(),
+			).Error("failed to restoreRepo")
+		}
+		outcomes[outcome] = append(outcomes[outcome], repo.Path)
+	}
+
+	if len(outcomes[RestoreOutcomeSkippedDirty]) != 0 {
+		a.log.With("submodules", outcomes[RestoreOutcomeSkippedDirty]).Warn("submodules skipped because of uncommitted changes")
+	}
+
+	counts := make(map[RestoreOutcome]int, len(outcomes))
+	for outcome, paths := range outcomes {
+		counts[outcome] = len(paths)
+	}
+	a.log.With("outcomes", counts).Info("Restore done")
+
+	return nil
+}
+
+func (a *App) restoreRepo(mainProjectRepo *git.Repository, repo LockedRepo, log *zap.SugaredLogger) (outcome RestoreOutcome, err error) {
+	log = log.With("submodule", repo.Path, "commit", repo.Commit)
+	log.Debug("restoring submodule...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("restoring submodule done")
+		}
+	}()
+
+	submodule, added, err := addSubmoduleToRepo(mainProjectRepo, &sync.Mutex{}, repo.Path, repo.URL, CloneOptions{}, log)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to addSubmoduleToRepo")
+	}
+	repoPath := a.getSubmodulePath(submodule)
+
+	// submodule can be registered in the main project but not cloned yet (e.g. fresh clone of the main project)
+	_, err = os.Stat(repoPath + "/.git")
+	if errors.Is(err, os.ErrNotExist) {
+		_, err = runGit(a.mainProjectPath, "submodule", "update", "--", repo.Path)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to submodule update")
+		}
+		added = true
+	} else if err != nil {
+		return "", errors.Wrap(err, "failed to os.Stat")
+	}
+
+	outcome = RestoreOutcomeRestored
+	if added {
+		outcome = RestoreOutcomeCloned
+	}
+
+	dirty, err := isWorktreeDirty(repoPath)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to isWorktreeDirty")
+	}
+	if dirty {
+		return RestoreOutcomeSkippedDirty, nil
+	}
+
+	head, err := runGit(repoPath, "rev-parse", "HEAD")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to rev-parse HEAD")
+	}
+	if head == repo.Commit {
+		if added {
+			return outcome, nil
+		}
+		return RestoreOutcomeAlready, nil
+	}
+
+	_, err = runGit(repoPath, "cat-file", "-e", repo.Commit+"^{commit}")
+	if err != nil {
+		_, err = runGit(repoPath, "fetch", "origin")
+		if err != nil {
+			return "", errors.Wrap(err, "failed to fetch")
+		}
+	}
+
+	_, err = runGit(repoPath, "switch", "--detach", repo.Commit)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to switch --detach")
+	}
+
+	return outcome, nil
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// sparseProfileConfigKey - git config key marking repos which sparse-checkout is managed by mpcreator
+const sparseProfileConfigKey = "mpcreator.sparseprofile"
+
+// SparseProfile - sparse-checkout cone patterns for projects (config section "sparse")
+type SparseProfile struct {
+	Projects []string `mapstructure:"projects"` // project paths in main project or patterns e.g. "platform/monorepo", "platform/*-mono"
+	Patterns []string `mapstructure:"patterns"` // directories to check out e.g. "services/billing", "libs/common"
+}
+
+// SparseProfiles - sparse-checkout profiles, the first matching profile is used
+type SparseProfiles []SparseProfile
+
+// Validate checks projects patterns and cone patterns of the profiles
+func (p SparseProfiles) Validate() (err error) {
+	for i, profile := range p {
+		if len(profile.Projects) == 0 {
+			return errors.Errorf("sparse profile %d: projects are empty", i)
+		}
+		if len(profile.Patterns) == 0 {
+			return errors.Errorf("sparse profile %d: patterns are empty", i)
+		}
+		for _, project := range profile.Projects {
+			_, err = path.Match(project, "")
+			if err != nil {
+				return errors.Wrapf(err, "sparse profile %d: invalid project pattern %q", i, project)
+			}
+		}
+	}
+
+	return nil
+}
+
+// patterns returns cone patterns of the first profile matching projectPath (path of the project in main project)
+func (p SparseProfiles) patterns(projectPath string) (patterns []string, found bool) {
+	for _, profile := range p {
+		for _, project := range profile.Projects {
+			if match, _ := path.Match(project, projectPath); match {
+				return profile.Patterns, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// isSparse returns true if repo uses sparse-checkout
+func isSparse(repoPath string) bool {
+	sparse, _ := runGit(repoPath, "config", "--bool", "--get", "core.sparseCheckout")
+	return sparse == "true"
+}
+
+// applySparseProfile reconciles sparse-checkout of the repo with cone patterns of it's profile.
+// If repo has no profile (found == false) sparse-checkout is disabled, but only if it was set by mpcreator.
+func applySparseProfile(repoPath string, patterns []string, found bool, log *zap.SugaredLogger) (changed bool, err error) {
+	managed, _ := runGit(repoPath, "config", "--bool", "--get", sparseProfileConfigKey)
+
+	if !found {
+		if managed != "true" {
+			return false, nil
+		}
+
+		_, err = runGit(repoPath, "sparse-checkout", "disable")
+		if err != nil {
+			return false, errors.Wrap(err, "failed to sparse-checkout disable")
+		}
+		_, err = runGit(repoPath, "config", "--unset", sparseProfileConfigKey)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to unset %s", sparseProfileConfigKey)
+		}
+		log.Info("sparse-checkout disabled")
+
+		return true, nil
+	}
+
+	want := normalizeSparsePatterns(patterns)
+	if isSparse(repoPath) {
+		list, err := runGit(repoPath, "sparse-checkout", "list")
+		if err != nil {
+			return false, errors.Wrap(err, "failed to sparse-checkout list")
+		}
+		if strings.Join(normalizeSparsePatterns(strings.Split(list, "\n")), "\n") == strings.Join(want, "\n") {
+			return false, nil
+		}
+	}
+
+	_, err = runGit(repoPath, append([]string{"sparse-checkout", "set", "--cone", "--"}, want...)...)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to sparse-checkout set")
+	}
+	_, err = runGit(repoPath, "config", "--bool", sparseProfileConfigKey, "true")
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to set %s", sparseProfileConfigKey)
+	}
+	log.With("patterns", want).Info("sparse-checkout updated")
+
+	return true, nil
+}
+
+// normalizeSparsePatterns trims slashes, drops empty patterns and sorts them
+func normalizeSparsePatterns(patterns []string) (normalized []string) {
+	normalized = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if pattern != "" {
+			normalized = append(normalized, pattern)
+		}
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"sort"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SwitchOptions - options for SwitchSubmodulesBranch
+type SwitchOptions struct {
+	Create          bool // create branch (from origin/<default branch>) if it is missing locally and on origin
+	FallbackDefault bool // switch to the default branch if branch is missing
+	Autostash       bool // stash uncommitted changes before switch and apply them after (otherwise dirty repos are skipped)
+}
+
+// SwitchOutcome - result of switchSubmoduleBranch
+type SwitchOutcome string
+
+const (
+	SwitchOutcomeSwitched        SwitchOutcome = "switched"
+	SwitchOutcomeAlready         SwitchOutcome = "already"
+	SwitchOutcomeCreated         SwitchOutcome = "created"
+	SwitchOutcomeFallbackDefault SwitchOutcome = "fallback-default"
+	SwitchOutcomeMissing         SwitchOutcome = "missing"
+	SwitchOutcomeSkippedDirty    SwitchOutcome = "skipped-dirty"
+	SwitchOutcomeFailed          SwitchOutcome = "failed"
+)
+
+// autostashMessage - message of the stash created by autostash options
+const autostashMessage = "mpcreator autostash"
+
+// SwitchSubmodulesBranch switches all selected submodules to the branch
+func (a *App) SwitchSubmodulesBranch(filter Filter, branch string, opts SwitchOptions) (err error) {
+	a.log.With(
+		"filter", filter,
+		"branch", branch,
+		"opts", opts,
+	).Info("SwitchSubmodulesBranch")
+
+	submodules, err := a.selectSubmodules(filter)
+	if err != nil {
+		return errors.Wrap(err, "failed to selectSubmodules")
+	}
+
+	outcomes := map[SwitchOutcome][]string{}
+	for _, submodule := range submodules {
+		outcome, err := a.switchSubmoduleBranch(submodule, branch, opts, a.log)
+		if err != nil {
+			outcome = SwitchOutcomeFailed
+			a.log.With(
+				"submodule", submodule.Config().Path,
+				"error", err.Error(),
+			).Error("failed to switchSubmoduleBranch")
+		}
+		outcomes[outcome] = append(outcomes[outcome], submodule.Config().Path)
+	}
+
+	lackingBranch := append(outcomes[SwitchOutcomeMissing], outcomes[SwitchOutcomeFallbackDefault]...)
+	sort.Strings(lackingBranch)
+	if len(lackingBranch) != 0 {
+		a.log.With("branch", branch, "submodules", lackingBranch).Warn("submodules without branch")
+	}
+	if len(outcomes[SwitchOutcomeSkippedDirty]) != 0 {
+		a.log.With("submodules", outcomes[SwitchOutcomeSkippedDirty]).Warn("submodules skipped because of uncommitted changes")
+	}
+
+	counts := make(map[SwitchOutcome]int, len(outcomes))
+	for outcome, paths := range outcomes {
+		counts[outcome] = len(paths)
+	}
+	a.log.With("outcomes", counts).Info("SwitchSubmodulesBranch done")
+
+	return nil
+}
+
+func (a *App) switchSubmoduleBranch(
+	submodule *git.Submodule,
+	branch string,
+	opts SwitchOptions,
+	log *zap.SugaredLogger,
+) (outcome SwitchOutcome, err error) {
+	log = log.With("submodule", submodule.Config().Name)
+	log.Debug("switching submodule...")
+	defer func() {
+		if err == nil {
+			log.With("outcome", outcome).Info("switching submodule done")
+		}
+	}()
+
+	repoPath := a.getSubmodulePath(submodule)
+
+	submoduleCurrentBranch, err := a.getSubmoduleCurrentBranch(submodule)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to getSubmoduleCurrentBranch")
+	}
+	log = log.With("submoduleCurrentBranch", submoduleCurrentBranch)
+
+	_, err = runGit(repoPath, "fetch", "origin")
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch")
+	}
+
+	target, outcome, startPoint := branch, SwitchOutcomeSwitched, ""
+	exists, err := branchExists(repoPath, branch)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to branchExists")
+	}
+	switch {
+	case exists:
+	case opts.Create:
+		// not from current HEAD, it may be any feature branch
+		defaultBranch, err := a.getSubmoduleDefaultBranch(submodule)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+		}
+		outcome, startPoint = SwitchOutcomeCreated, "origin/"+defaultBranch
+	case opts.FallbackDefault:
+		target, err = a.getSubmoduleDefaultBranch(submodule)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to getSubmoduleDefaultBranch")
+		}
+		outcome = SwitchOutcomeFallbackDefault
+	default:
+		return SwitchOutcomeMissing, nil
+	}
+
+	if target == submoduleCurrentBranch {
+		if outcome == SwitchOutcomeFallbackDefault {
+			return outcome, nil
+		}
+		return SwitchOutcomeAlready, nil
+	}
+
+	args := []string{"switch", target}
+	if outcome == SwitchOutcomeCreated {
+		args = []string{"switch", "--no-track", "-c", target, startPoint}
+	}
+	err = withAutostash(repoPath, opts.Autostash, log, func() (err error) {
+		_, err = runGit(repoPath, args...)
+		return err
+	})
+	switch {
+	case errors.Is(err, errDirtyWorktree):
+		log.Warn("contains uncommitted changes, skipping...")
+		return SwitchOutcomeSkippedDirty, nil
+	case err != nil:
+		return "", errors.Wrap(err, "failed to switch")
+	}
+
+	return outcome, nil
+}
+
+// branchExists returns true if branch exists locally or on origin
+func branchExists(repoPath, branch string) (exists bool, err error) {
+	for _, ref := range []string{"refs/heads/" + branch, "refs/remotes/origin/" + branch} {
+		_, err = runGit(repoPath, "show-ref", "--verify", "-q", ref)
+		if err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+var errDirtyWorktree = errors.New("worktree contains uncommitted changes")
+
+// withAutostash runs action on the clean worktree:
+// if worktree is dirty returns errDirtyWorktree or (if autostash) stashes changes and applies them after action.
+// If stashed changes can't be applied they stay in stash list.
+func withAutostash(repoPath string, autostash bool, log *zap.SugaredLogger, action func() (err error)) (err error) {
+	dirty, err := isWorktreeDirty(repoPath)
+	if err != nil {
+		return errors.Wrap(err, "failed to isWorktreeDirty")
+	}
+	if !dirty {
+		return action()
+	}
+	if !autostash {
+		return errDirtyWorktree
+	}
+
+	_, err = runGit(repoPath, "stash", "push", "-m", autostashMessage)
+	if err != nil {
+		return errors.Wrap(err, "failed to stash push")
+	}
+
+	actionErr := action()
+
+	_, err = runGit(repoPath, "stash", "pop")
+	if err != nil {
+		log.With(zap.Error(err)).Warn("failed to apply autostash, changes are kept in 'git stash list'")
+	}
+
+	return actionErr
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gitmodulesFile - submodules config shared by the team (committed to main project)
+const gitmodulesFile = ".gitmodules"
+
+// setSubmoduleTrackingBranch writes "branch" of submodule to .gitmodules and .git/config of main project
+// if it differs from the current value (changed == true)
+func (a *App) setSubmoduleTrackingBranch(submoduleName, branch string) (changed bool, err error) {
+	key := "submodule." + submoduleName + ".branch"
+
+	current, _ := runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, "--get", key) // error if key is missing
+	if current == branch {
+		return false, nil
+	}
+
+	_, err = runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, key, branch)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to write branch to "+gitmodulesFile)
+	}
+	_, err = runGit(a.mainProjectPath, "config", key, branch)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to write branch to .git/config")
+	}
+
+	return true, nil
+}
+
+// syncSubmodulesTrackingBranches copies "branch" of submodules from .gitmodules to .git/config of main project
+// (git submodule sync doesn't do it), so tracking branches are the same for all team members
+func (a *App) syncSubmodulesTrackingBranches() (err error) {
+	// exit code 1 if there are no keys
+	modulesBranches, _ := runGit(a.mainProjectPath, "config", "-f", gitmodulesFile, "--get-regexp", `^submodule\..*\.branch$`)
+
+	for _, line := range strings.Split(modulesBranches, "\n") {
+		key, branch, found := strings.Cut(line, " ")
+		if !found {
+			continue
+		}
+
+		current, _ := runGit(a.mainProjectPath, "config", "--get", key)
+		if current == branch {
+			continue
+		}
+
+		_, err = runGit(a.mainProjectPath, "config", key, branch)
+		if err != nil {
+			return errors.Wrapf(err, "failed to write %s to .git/config", key)
+		}
+		a.log.With("key", key, "branch", branch, "previous", current).Info("tracking branch synced from " + gitmodulesFile)
+	}
+
+	return nil
+}